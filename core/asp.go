@@ -56,19 +56,20 @@ var asp = &Plugin{
 				{Func: StringReplace, Arguments: []interface{}{"\"++\"", "", -1}},
 			},
 			Functions: []BaseFunc{},
+		}, {
+			// screnc编码的脚本，<%@ language=vbscript.encode %>或<script language="jscript.encode">，
+			// 整个文件中的编码块一并解码，解码后的代码保留在原来的位置
+			Name:       "asp/script_encoder",
+			Regex:      regexp.MustCompile(`(?s)^.*#@~\^[A-Za-z0-9+/]{6}==.*$`),
+			DataFilter: regexp.MustCompile(`(?s)^.*$`),
+			Functions:  []BaseFunc{ScriptDecode},
 		},
 	},
 	Tags: []Tag{
 		{Name: "asp/execution", Regex: regexp.MustCompile(`(?i)(?:e["+/*-]+v["+/*-]+a["+/*-]+l["+/*-]+\(|system\.diagnostics\.processstartinfo\(\w+\.substring\(|startinfo\.filename=\"?'?cmd\.exe"?'?|\seval\(request\.item\["?'?\w+"?'?\](?:,"?'?unsafe"?'?)?|execute(?:\(|\s+request\(\"\w+\"\))|RunCMD\(|\seval\(|COM\('?"?WScript\.(?:shell|network)"?'?|response\.write\()`), Scored: 80},
-		{Name: "asp/command", Regex: regexp.MustCompile(`(?i)\w+\.(?:ExecuteNonQuery|CreateCommand)\(`), Scored: 20},
 		{Name: "asp/disk_operations", Regex: regexp.MustCompile(`(?i)(?:createtextfile\(|server\.createobject\(\"Scripting\.FileSystemObject\"\))`), Scored: 50},
 		{Name: "asp/suspicious", Regex: regexp.MustCompile(`(?i)(?:deletefile\(server\.mappath\(\"\w+\.\w+\"\)\)|language\s+=\s+vbscript\.encode\s+%>(?:\s*|\r|\n)<%\s+response\.buffer=true:server\.scripttimeout=|(?i)language\s+=\s+vbscript\.encode%><%\n?\r?server\.scripttimeout=|executeglobal\(|server\.createobject\(\w+\(\w{1,5},\w{1,5}\)\))`), Scored: 60},
 		{Name: "asp/object_created", Regex: regexp.MustCompile(`(?i)server\.createobject\(\"(?:msxml2\.xmlhttp|microsoft\.xmlhttp|WSCRIPT\.SHELL|ADODB\.Connection)\"\)`), Scored: 55},
-		{Name: "asp/suspicious_import", Regex: regexp.MustCompile(`(?i)name(?:space)?="(?:system\.(?:serviceprocess|threading|(?:net\.sockets)))"?"`), Scored: 50},
-		{Name: "asp/process_threads", Regex: regexp.MustCompile(`(?:new\s+process\(\)|startinfo\.(?:filename|UseShellExecute|Redirect(?:StandardInput|StandardOutput|StandardError)|CreateNoWindow)|WaitForExit())`), Scored: 40},
-		{Name: "asp/database", Regex: regexp.MustCompile(`(?:(?:SqlDataAdapter|SqlConnection|SqlCommand)\(|System\.Data\.SqlClient|System\.Data\.OleDb|OleDbConnection\(\))`), Scored: 30},
-		{Name: "asp/behinder", Regex: regexp.MustCompile(`(?i)(session\.getValue\(.*AES.*\)|base64decoder|newInstance|session.Add\()`), Scored: 20, Repeat: true},
-		{Name: "asp/execution_2", Regex: regexp.MustCompile(`eval\((.*)Request.Item\[(.*)\](.*)\)`), Scored: 85},
 	},
-	Supports: []string{"asp", "aspx"},
+	Supports: []string{"asp", "asa", "cer", "cdx", "vbe", "jse"},
 }
@@ -0,0 +1,53 @@
+package core
+
+import "regexp"
+
+const (
+	ASPX = "aspx"
+)
+
+var aspx = &Plugin{
+	Name: ASPX,
+	Desc: "A plugin that detects webshell of asp.net type",
+	Decoders: []Decoder{
+		{
+			Name:       "aspx/from_base64_string",
+			Regex:      regexp.MustCompile(`(?:System\.)?Convert\.FromBase64String\s*\(\s*@?"[A-Za-z0-9+\/=]+"\s*\)`),
+			DataFilter: regexp.MustCompile(`"[A-Za-z0-9+\/=]+"`),
+			PreDecodeActions: []Action{
+				{Func: StringReplace, Arguments: []interface{}{"\"", "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		}, {
+			// Encoding.UTF8.GetString(new byte[] { 101, 118, 97, 108 })
+			Name:       "aspx/utf8_get_string",
+			Regex:      regexp.MustCompile(`(?:System\.Text\.)?Encoding\.(?:UTF8|ASCII|Default)\.GetString\s*\(\s*new\s+byte\s*\[\s*\]\s*\{[\d\s,]+\}\s*\)`),
+			DataFilter: regexp.MustCompile(`\{[\d\s,]+\}`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`[{}\s]`, "", -1}},
+				{Func: StringReplace, Arguments: []interface{}{",", "|", -1}},
+			},
+			Functions: []BaseFunc{CharDecode},
+		},
+	},
+	Tags: []Tag{
+		{Name: "aspx/execution", Regex: regexp.MustCompile(`(?i)(?:system\.diagnostics\.processstartinfo\(\w+\.substring\(|startinfo\.filename\s*=\s*"?'?cmd\.exe)`), Scored: 80},
+		{Name: "aspx/process", Regex: regexp.MustCompile(`(?:(?:System\.Diagnostics\.)?Process\.Start\s*\(|new\s+(?:System\.Diagnostics\.)?ProcessStartInfo\s*\()`), Scored: 50},
+		{Name: "aspx/process_threads", Regex: regexp.MustCompile(`(?:new\s+process\(\)|startinfo\.(?:filename|UseShellExecute|Redirect(?:StandardInput|StandardOutput|StandardError)|CreateNoWindow)|WaitForExit())`), Scored: 40},
+		{Name: "aspx/jscript_eval", Regex: regexp.MustCompile(`(?i)\beval\s*\([^;\n]*Request(?:\.(?:Item|Form|QueryString))?\s*[\[\(][^;\n]*\)`), Scored: 85},
+		{Name: "aspx/jscript_unsafe", Regex: regexp.MustCompile(`(?i)\beval\s*\([^;\n]*,\s*["']unsafe["']\s*\)`), Scored: 80},
+		{Name: "aspx/jscript_page", Regex: regexp.MustCompile(`(?i)<%@\s*(?:Page|WebHandler|WebService)\s[^%]*Language\s*=\s*"?J(?:ava)?Script`), Scored: 20},
+		{Name: "aspx/assembly_load", Regex: regexp.MustCompile(`(?:System\.Reflection\.)?Assembly\.Load(?:From|File)?\s*\(`), Scored: 40},
+		{Name: "aspx/assembly_load_base64", Regex: regexp.MustCompile(`Assembly\.Load\s*\(\s*(?:System\.)?Convert\.FromBase64String\s*\(`), Scored: 80},
+		{Name: "aspx/reflection", Regex: regexp.MustCompile(`(?:System\.Reflection|\.GetMethod\s*\(|\.InvokeMember\s*\(|Activator\.CreateInstance\s*\(|\.CreateInstance\s*\()`), Scored: 20, Repeat: true},
+		{Name: "aspx/cipher", Regex: regexp.MustCompile(`(?:new\s+(?:System\.Security\.Cryptography\.)?RijndaelManaged\s*\(\s*\)\s*\.Create(?:De|En)cryptor\s*\(|\.TransformFinalBlock\s*\()`), Scored: 20, Repeat: true},
+		{Name: "aspx/behinder", Regex: regexp.MustCompile(`(?:\.CreateInstance\s*\(\s*"U"\s*\)\.Equals\s*\(|Request\.BinaryRead\s*\(\s*Request\.ContentLength\s*\)|Session\.Add\s*\(\s*"k"\s*,)`), Scored: 60},
+		{Name: "aspx/godzilla", Regex: regexp.MustCompile(`(?s)(?:Session\s*\[\s*"payload"\s*\]|string\s+pass\s*=\s*"\w+"\s*;.{0,100}?string\s+md5\s*=)`), Scored: 80},
+		{Name: "aspx/web_config_handler", Regex: regexp.MustCompile(`(?i)<add\s[^>]*(?:path|extension)\s*=\s*"\*?\.(?:jpg|jpeg|png|gif|bmp|ico|txt|css|js|config)"[^>]*(?:PageHandlerFactory|PageBuildProvider|SimpleHandlerFactory|WebServiceHandlerFactory|scriptProcessor)`), Scored: 70},
+		{Name: "aspx/web_config_access_policy", Regex: regexp.MustCompile(`(?i)<handlers\s[^>]*accessPolicy\s*=\s*"[^"]*\bScript\b[^"]*\bWrite\b`), Scored: 40},
+		{Name: "aspx/command", Regex: regexp.MustCompile(`(?i)\w+\.(?:ExecuteNonQuery|CreateCommand)\(`), Scored: 20},
+		{Name: "aspx/suspicious_import", Regex: regexp.MustCompile(`(?i)name(?:space)?="(?:system\.(?:serviceprocess|threading|(?:net\.sockets)))"?"`), Scored: 50},
+		{Name: "aspx/database", Regex: regexp.MustCompile(`(?:(?:SqlDataAdapter|SqlConnection|SqlCommand)\(|System\.Data\.SqlClient|System\.Data\.OleDb|OleDbConnection\(\))`), Scored: 30},
+	},
+	Supports: []string{"aspx", "ashx", "asmx", "cshtml", "config"},
+}
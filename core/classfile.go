@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Java class文件的魔数
+const classFileMagic = "\xca\xfe\xba\xbe"
+
+// 常量池中各类型常量的长度，不含tag字节，Utf8为变长
+var constantSizes = map[byte]int{
+	3:  4, // Integer
+	4:  4, // Float
+	5:  8, // Long
+	6:  8, // Double
+	7:  2, // Class
+	8:  2, // String
+	9:  4, // Fieldref
+	10: 4, // Methodref
+	11: 4, // InterfaceMethodref
+	12: 4, // NameAndType
+	15: 3, // MethodHandle
+	16: 2, // MethodType
+	17: 4, // Dynamic
+	18: 4, // InvokeDynamic
+	19: 2, // Module
+	20: 2, // Package
+}
+
+func IsClassFile(data []byte) bool {
+	return len(data) >= 10 && bytes.HasPrefix(data, []byte(classFileMagic))
+}
+
+// 解析class文件的常量池，返回所有Utf8常量，包括类名、方法名、签名及字符串字面量
+func ClassFileStrings(data []byte) ([]string, error) {
+	if !IsClassFile(data) {
+		return nil, fmt.Errorf("[ClassFileStrings] Not a class file\n")
+	}
+	count := int(binary.BigEndian.Uint16(data[8:10]))
+	pos := 10
+	var strs []string
+	for i := 1; i < count; i++ {
+		if pos >= len(data) {
+			return strs, fmt.Errorf("[ClassFileStrings] Truncated constant pool at entry %d\n", i)
+		}
+		tag := data[pos]
+		pos++
+		if tag == 1 {
+			if pos+2 > len(data) {
+				return strs, fmt.Errorf("[ClassFileStrings] Truncated constant pool at entry %d\n", i)
+			}
+			n := int(binary.BigEndian.Uint16(data[pos : pos+2]))
+			pos += 2
+			if pos+n > len(data) {
+				return strs, fmt.Errorf("[ClassFileStrings] Truncated constant pool at entry %d\n", i)
+			}
+			strs = append(strs, decodeModifiedUTF8(data[pos:pos+n]))
+			pos += n
+			continue
+		}
+		size, ok := constantSizes[tag]
+		if !ok {
+			return strs, fmt.Errorf("[ClassFileStrings] Unknown constant tag %d at entry %d\n", tag, i)
+		}
+		pos += size
+		// Long和Double占用两个常量池项
+		if tag == 5 || tag == 6 {
+			i++
+		}
+	}
+	return strs, nil
+}
+
+// class文件使用的modified UTF-8：NUL编码为C0 80，增补字符编码为两个代理项
+func decodeModifiedUTF8(b []byte) string {
+	if utf8.Valid(b) && bytes.IndexByte(b, 0xed) < 0 {
+		return strings.ReplaceAll(string(b), "\xc0\x80", "\x00")
+	}
+	var units []uint16
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xe0 == 0xc0 && i+1 < len(b):
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0 && i+2 < len(b):
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			units = append(units, utf8.RuneError)
+			i++
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// class文件转换为常量池字符串，每行一个
+var JavaClassStrings BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	strs, err := ClassFileStrings(in)
+	if len(strs) == 0 {
+		return nil, err
+	}
+	return []byte(strings.Join(strs, "\n")), nil
+}
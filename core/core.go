@@ -3,14 +3,32 @@ package core
 import (
 	"bytes"
 	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf16"
+)
+
+const (
+	maxSnippetLength = 256
+	maxPreviewLength = 128
+	maxHitsPerTag    = 100 // 每层数据中同一规则最多记录的命中数
+)
+
+// 解码树的限制，可按需调整
+var (
+	MaxDecodeDepth  = 8                // 最大解码深度
+	MaxDecodeLayers = 10000            // 最多解码层数
+	MaxDecodeBytes  = 32 * 1024 * 1024 // 所有解码层的总字节数
 )
 
 type BaseFunc func(in []byte, args ...interface{}) ([]byte, error)
@@ -36,11 +54,72 @@ type Tag struct {
 	Repeat bool    // 标记规则是否需要重复计数
 }
 
+// 规则命中记录
+type Hit struct {
+	Plugin   string   `json:"plugin"`
+	Tag      string   `json:"tag"`
+	Snippet  string   `json:"snippet"`
+	Offset   int      `json:"offset"`             // 在所在数据层中的字节偏移
+	Line     int      `json:"line"`               // 在原始内容中的行号，解码层的命中对应最外层被解码数据所在行
+	Decoders []string `json:"decoders,omitempty"` // 揭示该命中的解码链，原始内容中的命中为空
+	Trace    []string `json:"trace,omitempty"`    // 数据流路径，如 $_POST['c'] -> $b -> eval
+}
+
+// 解码树节点，根节点为原始内容，子节点为解码器从父节点中解出的数据
+type Layer struct {
+	Decoder  string   `json:"decoder,omitempty"`
+	Hash     string   `json:"hash"`
+	Size     int      `json:"size"`
+	Depth    int      `json:"depth"`
+	Origin   int      `json:"origin"` // 最外层被解码数据在原始内容中的偏移
+	Preview  string   `json:"preview,omitempty"`
+	Children []*Layer `json:"children,omitempty"`
+	Parent   *Layer   `json:"-"`
+	data     string
+}
+
+// 从根节点到当前节点经过的解码器
+func (l *Layer) Chain() []string {
+	var chain []string
+	for n := l; n != nil && n.Parent != nil; n = n.Parent {
+		chain = append([]string{n.Decoder}, chain...)
+	}
+	return chain
+}
+
+// 形如"php/base64_decode -> php/gz_inflate_base64_decode -> eval($_POST[...]..."的描述
+func (l *Layer) String() string {
+	chain := append(l.Chain(), strconv.Quote(l.Preview))
+	return strings.Join(chain, " -> ")
+}
+
+type MatchResult struct {
+	Matches map[string]int32
+	Score   float64 // 正则得分，最大为100
+	Hits    []Hit
+	Root    *Layer
+}
+
+// 正则Tag以外的检测方式，如YARA规则，会作用于原始内容及每一层解码后的数据
+type Matcher interface {
+	Rules() []string
+	Match(data string) []MatcherHit
+}
+
+type MatcherHit struct {
+	Rule    string
+	Snippet string
+	Offset  int
+	Scored  float64
+	Trace   []string // 数据流经过的节点，如外部输入到危险函数的变量路径
+}
+
 type Plugin struct {
 	Name     string
 	Desc     string
 	Decoders []Decoder
 	Tags     []Tag
+	Matchers []Matcher
 	Supports []string
 }
 
@@ -48,8 +127,140 @@ var DecodeBase64 BaseFunc = func(in []byte, args ...interface{}) ([]byte, error)
 	return base64.StdEncoding.DecodeString(string(in))
 }
 
+// 解压后的数据最多MaxDecodeBytes字节，超出时返回错误，防止压缩炸弹耗尽内存
+func readDecompressed(r io.Reader) ([]byte, error) {
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(MaxDecodeBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxDecodeBytes {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", MaxDecodeBytes)
+	}
+	return out, nil
+}
+
 var GzInflate BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
-	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(in)))
+	return readDecompressed(flate.NewReader(bytes.NewReader(in)))
+}
+
+var ZlibUncompress BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	return readDecompressed(r)
+}
+
+var GzDecode BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	return readDecompressed(r)
+}
+
+var Rot13 BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	out := make([]byte, len(in))
+	for i, b := range in {
+		switch {
+		case b >= 'a' && b <= 'z':
+			out[i] = 'a' + (b-'a'+13)%26
+		case b >= 'A' && b <= 'Z':
+			out[i] = 'A' + (b-'A'+13)%26
+		default:
+			out[i] = b
+		}
+	}
+	return out, nil
+}
+
+var StringReverse BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	out := make([]byte, len(in))
+	for i, b := range in {
+		out[len(in)-1-i] = b
+	}
+	return out, nil
+}
+
+var Hex2Bin BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	return hex.DecodeString(strings.TrimSpace(string(in)))
+}
+
+// convert_uudecode，每行首字符表示该行解码后的长度
+var UUDecode BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	var out []byte
+	for _, line := range strings.Split(strings.ReplaceAll(string(in), "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		n := int(line[0]-32) & 63
+		if n == 0 {
+			break
+		}
+		var decoded []byte
+		for i := 1; i < len(line) && len(decoded) < n; i += 4 {
+			var group [4]byte
+			for j := 0; j < 4; j++ {
+				if i+j < len(line) {
+					group[j] = (line[i+j] - 32) & 63
+				}
+			}
+			decoded = append(decoded,
+				group[0]<<2|group[1]>>4,
+				group[1]<<4|group[2]>>2,
+				group[2]<<6|group[3])
+		}
+		if len(decoded) < n {
+			return nil, fmt.Errorf("[UUDecode] Bad line length: %q\n", line)
+		}
+		out = append(out, decoded[:n]...)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("[UUDecode] Nothing decoded\n")
+	}
+	return out, nil
+}
+
+// Java源码中的\uXXXX转义，u可以重复，前面有奇数个反斜杠时不是转义
+var UnicodeUnescape BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	var units []uint16
+	var out []byte
+	flush := func() {
+		if len(units) > 0 {
+			out = append(out, string(utf16.Decode(units))...)
+			units = units[:0]
+		}
+	}
+	backslashes := 0
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if c == '\\' && backslashes%2 == 0 && i+1 < len(in) && in[i+1] == 'u' {
+			j := i + 1
+			for j < len(in) && in[j] == 'u' {
+				j++
+			}
+			if j+4 <= len(in) {
+				if v, err := strconv.ParseUint(string(in[j:j+4]), 16, 16); err == nil {
+					units = append(units, uint16(v))
+					i = j + 3
+					backslashes = 0
+					continue
+				}
+			}
+		}
+		flush()
+		out = append(out, c)
+		if c == '\\' {
+			backslashes++
+		} else {
+			backslashes = 0
+		}
+	}
+	flush()
+	if bytes.Equal(out, in) {
+		return nil, fmt.Errorf("[UnicodeUnescape] Nothing unescaped\n")
+	}
+	return out, nil
 }
 
 var UrlDecode BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
@@ -127,9 +338,9 @@ var CharDecode BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
 }
 
 func GetPlugins() []*Plugin {
-	return []*Plugin{generic, asp, cfm, java, php}
+	return []*Plugin{generic, asp, aspx, cfm, java, php, python, perl, ruby, shell, node}
 }
 
 func GetCalculators() []*Calculator {
-	return []*Calculator{languageIC, entropy, longestWord, signatureNasty, useEval, compression}
+	return []*Calculator{languageIC, entropy, longestWord, signatureNasty, useEval, compression, phpTaint}
 }
\ No newline at end of file
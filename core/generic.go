@@ -8,7 +8,7 @@ const (
 
 var generic = &Plugin{
 	Name: GENERIC,
-	Desc: "A plugin that detects webshell of python or perl type",
+	Desc: "A plugin that detects webshell features common to all languages",
 	Decoders: []Decoder{
 		{
 			Name:       "generic/url_decode",
@@ -53,8 +53,6 @@ var generic = &Plugin{
 		{Name: "generic/registry_persistence", Regex: regexp.MustCompile(`(?i)(?:\\currentversion\\(?:run|runonce))`), Scored: 10, Repeat: true},
 		{Name: "generic/defense_evasion", Regex: regexp.MustCompile(`(?i)(?:strpos\(\$_SERVER\['HTTP_USER_AGENT'\],'Google'\))`), Scored: 50},
 		{Name: "generic/c_embedded_code", Regex: regexp.MustCompile(`(?i)(?:socket\(AF_INET,SOCK_STREAM|bind\(|listen\(|daemon\(1,0\))`), Scored: 20},
-		{Name: "generic/perl_embedded_code", Regex: regexp.MustCompile(`(?i)(?:getprotobyname\('tcp'\))|exec\s+\{'/bin/sh'\}\s+'-bash'`), Scored: 40},
-		{Name: "generic/python_embedded_code", Regex: regexp.MustCompile(`(?i)(?:)cgitb\.enable\(\)|print_exc\(|import\ssubprocess|os\.system\(|subprocess\.Popen\(|urllib\.urlretrieve\(`), Scored: 12, Repeat: true},
 		{Name: "generic/tcp_connected", Regex: regexp.MustCompile(`/dev/tcp/\d+\.\d+\.\d+\.\d+/\d+`), Scored: 55},
 	},
 	Supports: []string{},
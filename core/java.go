@@ -7,12 +7,39 @@ const (
 )
 
 var java = &Plugin{
-	Name:     JAVA,
-	Desc:     "A plugin that detects webshell of java type",
-	Decoders: []Decoder{},
+	Name: JAVA,
+	Desc: "A plugin that detects webshell of java type",
+	Decoders: []Decoder{
+		{
+			// 整个文件中的\uXXXX转义一并还原，使被转义的关键字可以被其他规则匹配
+			Name:       "java/unicode_escape",
+			Regex:      regexp.MustCompile(`(?s)^.*\\u+[0-9a-fA-F]{4}.*$`),
+			DataFilter: regexp.MustCompile(`(?s)^.*$`),
+			Functions:  []BaseFunc{UnicodeUnescape},
+		}, {
+			// 冰蝎、哥斯拉等内存马中base64编码的class字节码，可能被拆分为多段字符串拼接
+			Name:       "java/base64_class",
+			Regex:      regexp.MustCompile(`yv66vg[A-Za-z0-9+\/=]*(?:"\s*\+\s*"[A-Za-z0-9+\/=]+)*`),
+			DataFilter: regexp.MustCompile(`(?s)^.*$`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`"\s*\+\s*"`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64, JavaClassStrings},
+		},
+	},
 	Tags: []Tag{
 		{Name: "java/execution", Regex: regexp.MustCompile(`(?i)(?:runtime\.exec\()`), Scored: 50},
 		{Name: "java/one", Regex: regexp.MustCompile(`(?i)(request.getParameter\(|new java.io.FileOutputStream\()`), Scored: 14, Repeat: true},
+		{Name: "java/process_builder", Regex: regexp.MustCompile(`(?:new\s+(?:java\.lang\.)?ProcessBuilder\s*\(|ProcessImpl|UNIXProcess)`), Scored: 50},
+		{Name: "java/script_engine", Regex: regexp.MustCompile(`(?:new\s+(?:javax\.script\.)?ScriptEngineManager\s*\(|getEngineByName\s*\(\s*"(?i:js|javascript|nashorn|ecmascript)")`), Scored: 45},
+		{Name: "java/define_class", Regex: regexp.MustCompile(`(?:\.defineClass\s*\(|\bextends\s+ClassLoader\b|defineClass\s*\(\s*\w+\s*,\s*0\s*,)`), Scored: 50},
+		{Name: "java/cipher", Regex: regexp.MustCompile(`(?:Cipher\.getInstance\s*\(\s*"AES|new\s+(?:javax\.crypto\.spec\.)?SecretKeySpec\s*\()`), Scored: 20},
+		{Name: "java/session_key", Regex: regexp.MustCompile(`session\.(?:putValue|setAttribute)\s*\(\s*"\w{1,4}"\s*,`), Scored: 20},
+		{Name: "java/base64_decoder", Regex: regexp.MustCompile(`(?:sun\.misc\.BASE64Decoder|BASE64Decoder\s*\(\s*\)\s*\.decodeBuffer|Base64\.getDecoder\s*\(\s*\)\s*\.decode|org\.apache\.commons\.codec\.binary\.Base64)`), Scored: 15, Repeat: true},
+		{Name: "java/reflection", Regex: regexp.MustCompile(`(?:java\.lang\.reflect\.Method|Method\.invoke\s*\(|\.getDeclaredMethod\s*\(|\.getMethod\s*\(\s*"(?:exec|defineClass|invoke|getRuntime|start)"|Class\.forName\s*\(\s*"java\.lang\.(?:Runtime|ProcessBuilder|ClassLoader)")`), Scored: 25, Repeat: true},
+		{Name: "java/behinder", Regex: regexp.MustCompile(`(?:new\s+\w+\s*\(\s*this\.getClass\(\)\.getClassLoader\(\)\s*\)\.g\s*\(|\.newInstance\(\)\.equals\s*\(\s*pageContext\s*\))`), Scored: 80},
+		{Name: "java/godzilla", Regex: regexp.MustCompile(`(?s)String\s+xc\s*=\s*"[0-9a-f]{16}".{0,200}String\s+pass\s*=`), Scored: 80},
+		{Name: "java/memory_shell", Regex: regexp.MustCompile(`(?:StandardContext|ApplicationFilterConfig|FilterDef|FilterMap|addServletMappingDecoded|registerMapping|RequestMappingHandlerMapping)`), Scored: 20, Repeat: true},
 	},
-	Supports: []string{"jsp", "jspx", "java"},
+	Supports: []string{"jsp", "jspx", "java", "class"},
 }
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	NODE = "node"
+)
+
+var node = &Plugin{
+	Name: NODE,
+	Desc: "A plugin that detects webshell of node.js type",
+	Decoders: []Decoder{
+		{
+			Name:       "node/buffer_base64",
+			Regex:      regexp.MustCompile(`(?:Buffer\.from|new\s+Buffer)\s*\(\s*['"][A-Za-z0-9+\/=]+['"]\s*,\s*['"]base64['"]|\batob\s*\(\s*['"][A-Za-z0-9+\/=]+['"]`),
+			DataFilter: regexp.MustCompile(`\(\s*['"][A-Za-z0-9+\/=]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`[('"\s]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		}, {
+			Name:       "node/buffer_hex",
+			Regex:      regexp.MustCompile(`(?:Buffer\.from|new\s+Buffer)\s*\(\s*['"][0-9a-fA-F]+['"]\s*,\s*['"]hex['"]`),
+			DataFilter: regexp.MustCompile(`\(\s*['"][0-9a-fA-F]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`[('"\s]`, "", -1}},
+			},
+			Functions: []BaseFunc{Hex2Bin},
+		}, {
+			// String.fromCharCode(101, 118, 97, 108)、String.fromCharCode(...[101, 118])
+			Name:       "node/from_char_code",
+			Regex:      regexp.MustCompile(`String\.fromCharCode\s*\(\s*(?:\.\.\.\s*\[)?[\d\s,]+\]?\s*\)`),
+			DataFilter: regexp.MustCompile(`[\d\s,]+`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`\s`, "", -1}},
+				{Func: StringReplace, Arguments: []interface{}{",", "|", -1}},
+			},
+			Functions: []BaseFunc{CharDecode},
+		}, {
+			// 整个文件中的\xXX、\uXXXX及\u{X}转义一并还原
+			Name:       "node/escape",
+			Regex:      regexp.MustCompile(`(?s)^.*\\(?:x[0-9a-fA-F]{2}|u[0-9a-fA-F]{4}|u\{[0-9a-fA-F]{1,6}\}).*$`),
+			DataFilter: regexp.MustCompile(`(?s)^.*$`),
+			Functions:  []BaseFunc{JSUnescape},
+		}, {
+			// Dean Edwards packer：eval(function(p,a,c,k,e,d){...}('...',62,100,'...'.split('|'),0,{}))
+			Name:       "node/packer",
+			Regex:      regexp.MustCompile(`(?s)eval\s*\(\s*function\s*\(\s*p\s*,\s*a\s*,\s*c\s*,\s*k\s*,\s*e\s*,\s*[dr]\s*\).*?\.split\s*\(\s*['"]\|['"]\s*\)`),
+			DataFilter: regexp.MustCompile(`(?s)^.*$`),
+			Functions:  []BaseFunc{JSUnpack},
+		},
+	},
+	Tags: []Tag{
+		{Name: "node/child_process_input", Regex: regexp.MustCompile(`\b(?:exec|execSync|spawn|spawnSync|execFile|execFileSync)\s*\(\s*(?:req|request|ctx\.request)\.(?:query|body|params|headers|cookies)\b`), Scored: 85},
+		{Name: "node/child_process", Regex: regexp.MustCompile(`(?:require\s*\(\s*['"](?:node:)?child_process['"]\s*\)|from\s+['"](?:node:)?child_process['"])`), Scored: 30},
+		{Name: "node/eval_input", Regex: regexp.MustCompile(`(?:\beval|\bFunction|vm\.(?:runInNewContext|runInThisContext|runInContext|compileFunction)|new\s+vm\.Script)\s*\(\s*(?:req|request|ctx\.request)\.(?:query|body|params|headers|cookies)\b`), Scored: 85},
+		{Name: "node/eval_decoded", Regex: regexp.MustCompile(`(?:\beval|\bFunction|vm\.runIn\w*Context)\s*\(\s*(?:Buffer\.from\s*\(|atob\s*\(|String\.fromCharCode\s*\(|unescape\s*\(|decodeURIComponent\s*\()`), Scored: 60},
+		{Name: "node/vm", Regex: regexp.MustCompile(`vm\.(?:runInNewContext|runInThisContext|runInContext)\s*\(`), Scored: 20, Repeat: true},
+		{Name: "node/reverse_shell", Regex: regexp.MustCompile(`(?s)(?:require\s*\(\s*['"](?:node:)?net['"]\s*\)|new\s+net\.Socket\s*\(|net\.connect\s*\().{0,400}?(?:spawn\s*\(\s*['"](?:/bin/)?(?:ba|z)?sh['"]|\.pipe\s*\(\s*\w+\.stdin\s*\))`), Scored: 80},
+		{Name: "node/process_binding", Regex: regexp.MustCompile(`process\.binding\s*\(\s*['"]spawn_sync['"]\s*\)`), Scored: 70},
+		{Name: "node/sandbox_escape", Regex: regexp.MustCompile(`(?:process\.mainModule\.require\s*\(|constructor\.constructor\s*\(\s*['"]return\s+process)`), Scored: 60},
+	},
+	Supports: []string{"js", "mjs", "cjs", "ts"},
+}
+
+// 解析\xXX、\uXXXX及\u{X}转义，返回码元及消耗的字节数（不含反斜杠），不是转义时返回0
+func jsEscape(b []byte) (rune, int) {
+	switch {
+	case len(b) >= 3 && b[0] == 'x':
+		if v, err := strconv.ParseUint(string(b[1:3]), 16, 8); err == nil {
+			return rune(v), 3
+		}
+	case len(b) >= 4 && b[0] == 'u' && b[1] == '{':
+		end := bytes.IndexByte(b, '}')
+		if end > 2 && end <= 8 {
+			if v, err := strconv.ParseUint(string(b[2:end]), 16, 32); err == nil && v <= 0x10ffff {
+				return rune(v), end + 1
+			}
+		}
+	case len(b) >= 5 && b[0] == 'u':
+		if v, err := strconv.ParseUint(string(b[1:5]), 16, 16); err == nil {
+			return rune(v), 5
+		}
+	}
+	return 0, 0
+}
+
+// JavaScript字符串中的\xXX、\uXXXX及\u{X}转义，前面有奇数个反斜杠时不是转义
+var JSUnescape BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	var out []byte
+	changed := false
+	backslashes := 0
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if c == '\\' && backslashes%2 == 0 && i+1 < len(in) {
+			if r, n := jsEscape(in[i+1:]); n > 0 {
+				i += n
+				// 代理对合并为一个字符
+				if utf16.IsSurrogate(r) && i+2 < len(in) && in[i+1] == '\\' {
+					if r2, n2 := jsEscape(in[i+2:]); n2 > 0 {
+						if dr := utf16.DecodeRune(r, r2); dr != 0xfffd {
+							r = dr
+							i += n2 + 1
+						}
+					}
+				}
+				out = append(out, string(r)...)
+				changed = true
+				backslashes = 0
+				continue
+			}
+		}
+		out = append(out, c)
+		if c == '\\' {
+			backslashes++
+		} else {
+			backslashes = 0
+		}
+	}
+	if !changed {
+		return nil, fmt.Errorf("[JSUnescape] Nothing unescaped\n")
+	}
+	return out, nil
+}
+
+// packer调用的参数：payload、进制、关键字个数及以|分隔的关键字
+var jsPackerArgs = regexp.MustCompile(`(?s)\}\s*\(\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")\s*,\s*(\d+)\s*,\s*(\d+)\s*,\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")\s*\.split\s*\(\s*['"]\|['"]\s*\)`)
+
+var jsPackerWord = regexp.MustCompile(`\b\w+\b`)
+
+var jsStringUnescaper = strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\"`, `"`)
+
+// 最多还原的关键字个数
+const maxPackerWords = 100000
+
+// 与packer中的e函数相同，将序号编码为payload中的单词
+func jsPackerEncode(c, a int) string {
+	s := ""
+	if c >= a {
+		s = jsPackerEncode(c/a, a)
+	}
+	c %= a
+	if c > 35 {
+		return s + string(rune(c+29))
+	}
+	return s + strconv.FormatInt(int64(c), 36)
+}
+
+// 还原Dean Edwards packer压缩的代码，payload中的单词按序号替换为对应的关键字
+var JSUnpack BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	m := jsPackerArgs.FindSubmatch(in)
+	if m == nil {
+		return nil, fmt.Errorf("[JSUnpack] Packer arguments not found\n")
+	}
+	payload := string(m[1]) + string(m[2])
+	keywords := strings.Split(jsStringUnescaper.Replace(string(m[5])+string(m[6])), "|")
+	radix, _ := strconv.Atoi(string(m[3]))
+	count, _ := strconv.Atoi(string(m[4]))
+	if radix < 2 || radix > 95 || count > maxPackerWords {
+		return nil, fmt.Errorf("[JSUnpack] Bad packer arguments: radix %d, count %d\n", radix, count)
+	}
+	if count > len(keywords) {
+		count = len(keywords)
+	}
+
+	words := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		if keywords[i] != "" {
+			words[jsPackerEncode(i, radix)] = keywords[i]
+		}
+	}
+	out := jsPackerWord.ReplaceAllStringFunc(jsStringUnescaper.Replace(payload), func(w string) string {
+		if k, ok := words[w]; ok {
+			return k
+		}
+		return w
+	})
+	return []byte(out), nil
+}
@@ -15,36 +15,55 @@ const (
 )
 
 type CalculateFunc func(data string) float64
+
+// 根据CheckRegexMatches的结果计算，复用插件中Matcher的分析结果
+type ResultCalculateFunc func(mr *MatchResult) float64
+
 type Calculator struct {
+	Name            string
 	Weight          float64
 	CalculateMethod int
 	Coefficient     float64
 	Func            CalculateFunc
+	ResultFunc      ResultCalculateFunc // 有检测结果时代替Func
 }
 
 func (c *Calculator) Uniformization(data string) float64 {
+	return c.uniform(c.Func(data))
+}
+
+// 有检测结果且设置了ResultFunc时不再重新分析data
+func (c *Calculator) UniformizationResult(mr *MatchResult, data string) float64 {
+	if mr != nil && c.ResultFunc != nil {
+		return c.uniform(c.ResultFunc(mr))
+	}
+	return c.Uniformization(data)
+}
+
+func (c *Calculator) uniform(v float64) float64 {
 	value := float64(0)
 	switch c.CalculateMethod {
 	case RateAsValue:
-		value = c.Func(data) * c.Coefficient * c.Weight
+		value = v * c.Coefficient * c.Weight
 	case FuncAsValue:
-		value = 1 / (1 + math.Pow(math.E, (c.Coefficient-4.0)-c.Func(data))) * c.Weight
+		value = 1 / (1 + math.Pow(math.E, (c.Coefficient-4.0)-v)) * c.Weight
 	case ExistAsValue:
-		if c.Func(data) > 0 {
+		if v > 0 {
 			value = c.Weight * c.Coefficient
 		}
 	case CompareAsValue:
-		if c.Func(data) > c.Coefficient {
+		if v > c.Coefficient {
 			value = c.Weight
 		}
 	default:
-		value = c.Func(data) * c.Weight
+		value = v * c.Weight
 	}
 
 	return value
 }
 
 var languageIC = &Calculator{
+	Name:            "language_ic",
 	Weight:          1,
 	CalculateMethod: RateAsValue,
 	Coefficient:     1,
@@ -80,6 +99,7 @@ var languageIC = &Calculator{
 }
 
 var entropy = &Calculator{
+	Name:            "entropy",
 	Weight:          1,
 	CalculateMethod: FuncAsValue,
 	Coefficient:     6,
@@ -119,6 +139,7 @@ var entropy = &Calculator{
 }
 
 var longestWord = &Calculator{
+	Name:            "longest_word",
 	Weight:          1,
 	CalculateMethod: CompareAsValue,
 	Coefficient:     256,
@@ -140,6 +161,7 @@ var longestWord = &Calculator{
 }
 
 var signatureNasty = &Calculator{
+	Name:            "signature_nasty",
 	Weight:          1,
 	CalculateMethod: ExistAsValue,
 	Coefficient:     1,
@@ -152,6 +174,7 @@ var signatureNasty = &Calculator{
 }
 
 var useEval = &Calculator{
+	Name:            "use_eval",
 	Weight:          1,
 	CalculateMethod: ExistAsValue,
 	Coefficient:     1,
@@ -164,6 +187,7 @@ var useEval = &Calculator{
 }
 
 var compression = &Calculator{
+	Name:            "compression",
 	Weight:          1,
 	CalculateMethod: RateAsValue,
 	Coefficient:     1,
@@ -180,3 +204,25 @@ var compression = &Calculator{
 	},
 }
 
+// 只分析PHP文件，检测时直接使用PHP插件中污点分析的结果
+var phpTaint = &Calculator{
+	Name:            "php_taint",
+	Weight:          1,
+	CalculateMethod: ExistAsValue,
+	Coefficient:     1,
+	Func: func(data string) float64 {
+		if sniffLanguage(data).lang != "php" {
+			return 0
+		}
+		return float64(PHPTaintCount(data))
+	},
+	ResultFunc: func(mr *MatchResult) float64 {
+		count := 0
+		for _, hit := range mr.Hits {
+			if _, ok := phpTaintScores[hit.Tag]; ok && hit.Plugin == PHP && len(hit.Decoders) == 0 {
+				count++
+			}
+		}
+		return float64(count)
+	},
+}
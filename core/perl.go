@@ -0,0 +1,49 @@
+package core
+
+import "regexp"
+
+const (
+	PERL = "perl"
+)
+
+var perl = &Plugin{
+	Name: PERL,
+	Desc: "A plugin that detects webshell of perl type",
+	Decoders: []Decoder{
+		{
+			// eval unpack u=>q{...}，内容为uuencode编码
+			Name:       "perl/unpack_uu",
+			Regex:      regexp.MustCompile(`unpack\s*\(?\s*(?:['"]u['"]|u)\s*(?:,|=>)\s*(?:q\{[^}]+\}|'[^']+'|"[^"]+")`),
+			DataFilter: regexp.MustCompile(`(?:q\{[^}]+\}|'[^']{2,}'|"[^"]{2,}")`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`^q\{|\}$|^['"]|['"]$`, "", -1}},
+			},
+			Functions: []BaseFunc{UUDecode},
+		}, {
+			Name:       "perl/pack_hex",
+			Regex:      regexp.MustCompile(`pack\s*\(?\s*['"]H\*['"]\s*,\s*['"][0-9a-fA-F]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][0-9a-fA-F]{2,}['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{Hex2Bin},
+		}, {
+			Name:       "perl/base64_decode",
+			Regex:      regexp.MustCompile(`decode_base64\s*\(?\s*['"][A-Za-z0-9+\/=\s]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][A-Za-z0-9+\/=\s]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"\s]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		},
+	},
+	Tags: []Tag{
+		{Name: "perl/eval_unpack", Regex: regexp.MustCompile(`\beval\s*\(?\s*(?:unpack|pack|decode_base64|MIME::Base64::decode)\b`), Scored: 70},
+		{Name: "perl/socket", Regex: regexp.MustCompile(`(?s)IO::Socket::INET->new\s*\(.{0,200}?Peer(?:Addr|Host)|getprotobyname\s*\(\s*['"]tcp['"]\s*\)`), Scored: 40},
+		{Name: "perl/reverse_shell", Regex: regexp.MustCompile(`open\s*\(\s*STD(?:IN|OUT|ERR)\s*,\s*["']?[<>]&`), Scored: 60},
+		{Name: "perl/exec_shell", Regex: regexp.MustCompile(`\bexec\s*\(?\s*(?:\{\s*)?["'](?:/bin/)?(?:ba)?sh(?:\s+-i)?["']`), Scored: 60},
+		{Name: "perl/cgi_command", Regex: regexp.MustCompile("(?s)(?:->param\\s*\\(|\\bparam\\s*\\(\\s*['\"]\\w+['\"]\\s*\\)|\\$ENV\\{['\"]?QUERY_STRING['\"]?\\}).{0,300}?(?:\\bsystem\\s*\\(|\\bexec\\s*\\(|\\bqx\\s*[{(/|]|`)"), Scored: 50},
+		{Name: "perl/command", Regex: regexp.MustCompile(`(?:\bsystem\s*\(|\bqx\s*[{(/|]|\bopen\s*\(\s*\w+\s*,\s*["']\s*\|)`), Scored: 15, Repeat: true},
+	},
+	Supports: []string{"pl", "pm", "cgi"},
+}
@@ -1,6 +1,10 @@
 package core
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 const (
 	PHP = "php"
@@ -59,6 +63,11 @@ var php = &Plugin{
 				{Func: StringReplace, Arguments: []interface{}{".", "", -1}},
 			},
 			Functions: []BaseFunc{CharDecode},
+		}, {
+			Name:       "php/call_chain",
+			Regex:      phpCallChainRegex,
+			DataFilter: phpCallChainRegex,
+			Functions:  []BaseFunc{PHPCallChain},
 		},
 	},
 	Tags: []Tag{
@@ -77,5 +86,88 @@ var php = &Plugin{
 		{Name: "php/execution_3", Regex: regexp.MustCompile(`(?i)(server.MapPath\(Request\[(.*)\](.*)\))`), Scored: 80},
 		{Name: "php/execution_4", Regex: regexp.MustCompile(`(system\(|assert\(|eval\()(.*)\$\_(POST|REQUEST)\[`), Scored: 75},
 	},
+	Matchers: []Matcher{phpLexerMatcher{}},
 	Supports: []string{"php"},
 }
+
+// 任意嵌套的解码函数调用，如eval(gzuncompress(str_rot13(base64_decode('...'))))，最内层可以是pack('H*', '...')
+var phpCallChainRegex = regexp.MustCompile(`(?i)(?:(?:base64_decode|str_rot13|gzinflate|gzuncompress|gzdecode|strrev|hex2bin|convert_uudecode|urldecode|rawurldecode)\s*\(\s*)*(?:(?:base64_decode|str_rot13|gzinflate|gzuncompress|gzdecode|strrev|hex2bin|convert_uudecode|urldecode|rawurldecode)\s*\(\s*(?:'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*")|pack\s*\(\s*['"]H\*['"]\s*,\s*(?:'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"))(?:\s*\))+`)
+
+var phpCallRegex = regexp.MustCompile(`(?i)^\s*(base64_decode|str_rot13|gzinflate|gzuncompress|gzdecode|strrev|hex2bin|convert_uudecode|urldecode|rawurldecode|pack)\s*\(\s*`)
+
+var phpDecodeFunctions = map[string]BaseFunc{
+	"base64_decode":    DecodeBase64,
+	"str_rot13":        Rot13,
+	"gzinflate":        GzInflate,
+	"gzuncompress":     ZlibUncompress,
+	"gzdecode":         GzDecode,
+	"strrev":           StringReverse,
+	"hex2bin":          Hex2Bin,
+	"convert_uudecode": UUDecode,
+	"urldecode":        UrlDecode,
+	"rawurldecode":     UrlDecode,
+}
+
+// 解析单引号或双引号字符串字面量，转义规则与词法分析相同，返回内容及剩余部分
+func phpStringLiteral(s string) (string, string, error) {
+	if s == "" || (s[0] != '\'' && s[0] != '"') {
+		return "", s, fmt.Errorf("[PHPCallChain] String literal expected: %q\n", s)
+	}
+	var text string
+	var end int
+	if s[0] == '\'' {
+		text, end = lexPHPSingleQuoted(s, 0)
+	} else {
+		text, end = lexPHPDoubleQuoted(s, 0, '"')
+	}
+	// 字面量之后至少还有调用的右括号
+	if end >= len(s) {
+		return "", s, fmt.Errorf("[PHPCallChain] Unterminated string literal\n")
+	}
+	return text, s[end:], nil
+}
+
+// 依次解析嵌套的函数调用，从最内层的字符串开始向外执行对应的解码函数
+var PHPCallChain BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	rest := string(in)
+	var calls []string
+	for {
+		m := phpCallRegex.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		calls = append(calls, strings.ToLower(m[1]))
+		rest = rest[len(m[0]):]
+		if strings.ToLower(m[1]) == "pack" {
+			format, r, err := phpStringLiteral(rest)
+			if err != nil || format != "H*" {
+				return nil, fmt.Errorf("[PHPCallChain] Unsupported pack format: %q\n", format)
+			}
+			rest = strings.TrimLeft(strings.TrimSpace(r), ",")
+			rest = strings.TrimSpace(rest)
+			break
+		}
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("[PHPCallChain] No function call found\n")
+	}
+
+	literal, _, err := phpStringLiteral(rest)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(literal)
+	for i := len(calls) - 1; i >= 0; i-- {
+		f, ok := phpDecodeFunctions[calls[i]]
+		if calls[i] == "pack" {
+			f, ok = Hex2Bin, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("[PHPCallChain] Unsupported function: %s\n", calls[i])
+		}
+		if data, err = f(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
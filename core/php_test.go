@@ -0,0 +1,74 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPHPCallChain(t *testing.T) {
+	const payload = `system($_GET["cmd"]);`
+	tests := []struct {
+		file   string
+		chain  string
+		expect string
+	}{
+		{"rot13.php", "str_rot13", payload},
+		{"base64.php", "base64_decode", payload},
+		{"gzuncompress.php", "gzuncompress(base64_decode", payload},
+		{"strrev.php", "strrev", payload},
+		{"hex2bin.php", "hex2bin", payload},
+		{"pack.php", "pack", payload},
+		{"convert_uudecode.php", "convert_uudecode", payload},
+		{"gzinflate_rot13.php", "gzinflate(str_rot13(base64_decode", payload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := ioutil.ReadFile(filepath.Join("testdata", "phpchain", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			call := phpCallChainRegex.FindString(string(content))
+			if call == "" {
+				t.Fatalf("no call chain %s found in %q", tt.chain, content)
+			}
+			decoded, err := PHPCallChain([]byte(call))
+			if err != nil {
+				t.Fatalf("decode %q error: %v", call, err)
+			}
+			if string(decoded) != tt.expect {
+				t.Errorf("decode %q = %q, want %q", call, decoded, tt.expect)
+			}
+
+			// 检测时解码结果作为根节点的子节点
+			mr := CheckRegexMatches([]*Plugin{php}, string(content), tt.file)
+			found := false
+			for _, l := range mr.Root.Children {
+				if l.Decoder == "php/call_chain" && l.Preview == tt.expect {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("decoded layer %q not found in %s", tt.expect, tt.file)
+			}
+		})
+	}
+}
+
+func TestPHPStringLiteral(t *testing.T) {
+	tests := []struct {
+		in, text, rest string
+	}{
+		{`'a\'b\\c\n')`, `a'b\c\n`, ")"},
+		{`"\x41\101\t\$x")`, "AA\t$x", ")"},
+	}
+	for _, tt := range tests {
+		text, rest, err := phpStringLiteral(tt.in)
+		if err != nil || text != tt.text || rest != tt.rest {
+			t.Errorf("phpStringLiteral(%q) = %q, %q, %v, want %q, %q", tt.in, text, rest, err, tt.text, tt.rest)
+		}
+	}
+	if _, _, err := phpStringLiteral(`'abc`); err == nil {
+		t.Errorf("unterminated literal should return an error")
+	}
+}
@@ -0,0 +1,886 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 基于词法分析的PHP检测：去除注释，折叠字符串拼接，还原赋值为常量的变量，
+// 并在函数内部做轻量的污点分析，跟踪外部输入经过变量、数组传递到代码执行、文件写入及文件包含的路径，
+// 如 $b = $_POST['z']; $a = base64_decode('YXNzZXJ0'); $a($b);
+const (
+	phpTaintExecRule      = "php/taint_exec"
+	phpTaintFileWriteRule = "php/taint_file_write"
+	phpTaintIncludeRule   = "php/taint_include"
+	phpDynamicSinkRule    = "php/lexer_dynamic_sink"
+
+	// 污点路径最多记录的节点数
+	maxTaintTrace = 16
+)
+
+var phpTaintScores = map[string]float64{
+	phpTaintExecRule:      80,
+	phpTaintFileWriteRule: 40,
+	phpTaintIncludeRule:   70,
+}
+
+var phpSinkFunctions = map[string]string{
+	"eval":                 phpTaintExecRule,
+	"assert":               phpTaintExecRule,
+	"system":               phpTaintExecRule,
+	"exec":                 phpTaintExecRule,
+	"shell_exec":           phpTaintExecRule,
+	"passthru":             phpTaintExecRule,
+	"popen":                phpTaintExecRule,
+	"proc_open":            phpTaintExecRule,
+	"pcntl_exec":           phpTaintExecRule,
+	"create_function":      phpTaintExecRule,
+	"call_user_func":       phpTaintExecRule,
+	"call_user_func_array": phpTaintExecRule,
+	"array_map":            phpTaintExecRule,
+	"array_filter":         phpTaintExecRule,
+	"preg_replace":         phpTaintExecRule,
+	"file_put_contents":    phpTaintFileWriteRule,
+	"fwrite":               phpTaintFileWriteRule,
+	"fputs":                phpTaintFileWriteRule,
+	"move_uploaded_file":   phpTaintFileWriteRule,
+	"copy":                 phpTaintFileWriteRule,
+}
+
+// 只检查其中一个参数的危险函数：回调函数只检查回调参数，文件复制只检查目标路径
+var phpSinkArgs = map[string]int{
+	"call_user_func":       0,
+	"call_user_func_array": 0,
+	"array_map":            0,
+	"array_filter":         1,
+	"move_uploaded_file":   1,
+	"copy":                 1,
+}
+
+var phpIncludeKeywords = map[string]bool{
+	"include":      true,
+	"include_once": true,
+	"require":      true,
+	"require_once": true,
+}
+
+var phpSuperGlobals = map[string]bool{
+	"_GET":               true,
+	"_POST":              true,
+	"_REQUEST":           true,
+	"_COOKIE":            true,
+	"_FILES":             true,
+	"_SERVER":            true,
+	"_ENV":               true,
+	"HTTP_RAW_POST_DATA": true,
+}
+
+// $_SERVER中由客户端控制的项，其余如DOCUMENT_ROOT不是外部输入
+var phpServerInputs = map[string]bool{
+	"QUERY_STRING": true,
+	"REQUEST_URI":  true,
+	"PHP_SELF":     true,
+	"PATH_INFO":    true,
+}
+
+var phpSourceFunctions = map[string]bool{
+	"getallheaders":          true,
+	"apache_request_headers": true,
+}
+
+// 返回值不再携带外部输入内容的函数
+var phpSanitizers = map[string]bool{
+	"intval":           true,
+	"floatval":         true,
+	"boolval":          true,
+	"isset":            true,
+	"empty":            true,
+	"is_numeric":       true,
+	"is_string":        true,
+	"is_array":         true,
+	"count":            true,
+	"strlen":           true,
+	"md5":              true,
+	"sha1":             true,
+	"crc32":            true,
+	"in_array":         true,
+	"array_key_exists": true,
+}
+
+var phpCasts = map[string]bool{
+	"int":     true,
+	"integer": true,
+	"bool":    true,
+	"boolean": true,
+	"float":   true,
+	"double":  true,
+}
+
+var phpInterpolatedVarRegex = regexp.MustCompile(`\$\{?([A-Za-z_\x80-\xff][0-9A-Za-z_\x80-\xff]*)`)
+
+type phpLexerMatcher struct{}
+
+func (phpLexerMatcher) Rules() []string {
+	return []string{phpTaintExecRule, phpTaintFileWriteRule, phpTaintIncludeRule, phpDynamicSinkRule}
+}
+
+func (phpLexerMatcher) Match(data string) []MatcherHit {
+	a := &phpAnalysis{
+		src:    data,
+		tokens: normalizePHPTokens(lexPHP(data)),
+		scope:  newPHPScope(),
+	}
+	a.indexBrackets()
+	for i := range a.tokens {
+		a.enterScope(i)
+		a.foreach(i)
+		a.assignment(i)
+		a.call(i)
+		a.include(i)
+	}
+	return a.hits
+}
+
+// 污点分析发现的外部输入到达危险函数的次数，作为模型的一个特征
+func PHPTaintCount(data string) int {
+	count := 0
+	for _, hit := range (phpLexerMatcher{}).Match(data) {
+		if _, ok := phpTaintScores[hit.Rule]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+// ${'name'} 转换为普通变量
+func normalizePHPTokens(tokens []phpToken) []phpToken {
+	out := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.is(phpTokOp, "$") && i+3 < len(tokens) && tokens[i+1].is(phpTokOp, "{") &&
+			tokens[i+2].kind == phpTokString && tokens[i+3].is(phpTokOp, "}") {
+			out = append(out, phpToken{kind: phpTokVariable, text: tokens[i+2].text, offset: t.offset, end: tokens[i+3].end})
+			i += 3
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// 变量作用域，分析只在函数内部进行，函数参数视为不含外部输入
+type phpScope struct {
+	// 当前值可以静态求出的变量
+	consts map[string]string
+	// 来自外部输入的变量及其传递路径
+	taint map[string][]string
+	// 作用域内赋值过的变量
+	assigned map[string]bool
+	// 调用过extract($_GET)等函数时，未赋值的变量均视为外部输入
+	extracted []string
+}
+
+func newPHPScope() *phpScope {
+	return &phpScope{
+		consts:   make(map[string]string),
+		taint:    make(map[string][]string),
+		assigned: make(map[string]bool),
+	}
+}
+
+type phpFrame struct {
+	end    int
+	parent *phpScope
+}
+
+type phpAnalysis struct {
+	src    string
+	tokens []phpToken
+	scope  *phpScope
+	frames []phpFrame
+	hits   []MatcherHit
+	// 每个括号匹配的另一个括号的位置，没有匹配时为-1
+	pairs []int
+	// 从每个位置开始的表达式结束的位置
+	ends []int
+}
+
+func (a *phpAnalysis) isOpenBracket(t phpToken) bool {
+	return t.kind == phpTokOp && (t.text == "(" || t.text == "[" || t.text == "{")
+}
+
+func (a *phpAnalysis) isCloseBracket(t phpToken) bool {
+	return t.kind == phpTokOp && (t.text == ")" || t.text == "]" || t.text == "}")
+}
+
+// 一次遍历计算括号的匹配关系及每个位置的表达式结束位置，避免每个token重复向后扫描
+func (a *phpAnalysis) indexBrackets() {
+	n := len(a.tokens)
+	a.pairs = make([]int, n)
+	var stack []int
+	for j, t := range a.tokens {
+		a.pairs[j] = -1
+		switch {
+		case a.isOpenBracket(t):
+			stack = append(stack, j)
+		case a.isCloseBracket(t) && len(stack) > 0:
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			a.pairs[open], a.pairs[j] = j, open
+		}
+	}
+
+	// 表达式在同一层级的分号、逗号或未匹配的右括号处结束，未匹配的左括号之后的内容都属于该表达式
+	a.ends = make([]int, n+1)
+	a.ends[n] = n
+	for j := n - 1; j >= 0; j-- {
+		t := a.tokens[j]
+		switch {
+		case a.isCloseBracket(t), t.is(phpTokOp, ";"), t.is(phpTokOp, ","):
+			a.ends[j] = j
+		case a.isOpenBracket(t):
+			if a.pairs[j] < 0 {
+				a.ends[j] = n
+			} else {
+				a.ends[j] = a.ends[a.pairs[j]+1]
+			}
+		default:
+			a.ends[j] = a.ends[j+1]
+		}
+	}
+}
+
+// 表达式结束的位置：同一层级的分号、逗号或未匹配的右括号
+func (a *phpAnalysis) exprEnd(i int) int {
+	if i >= len(a.tokens) {
+		return len(a.tokens)
+	}
+	return a.ends[i]
+}
+
+// 与i处左括号匹配的右括号位置，没有时返回最后一个token
+func (a *phpAnalysis) matchParen(i int) int {
+	if i < len(a.tokens) && a.isOpenBracket(a.tokens[i]) {
+		if a.pairs[i] >= 0 {
+			return a.pairs[i]
+		}
+		return len(a.tokens) - 1
+	}
+	// 不是左括号时与之后第一个左括号匹配
+	depth := 0
+	for j := i; j < len(a.tokens); j++ {
+		switch {
+		case a.isOpenBracket(a.tokens[j]):
+			depth++
+		case a.isCloseBracket(a.tokens[j]):
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(a.tokens) - 1
+}
+
+// 与i处右括号匹配的左括号位置，没有时返回-1
+func (a *phpAnalysis) matchParenBackward(i int) int {
+	if i < 0 || i >= len(a.tokens) || !a.isCloseBracket(a.tokens[i]) {
+		return -1
+	}
+	return a.pairs[i]
+}
+
+// 进入或离开函数体，use及global声明的变量从外层作用域继承
+func (a *phpAnalysis) enterScope(i int) {
+	for len(a.frames) > 0 && i > a.frames[len(a.frames)-1].end {
+		a.scope = a.frames[len(a.frames)-1].parent
+		a.frames = a.frames[:len(a.frames)-1]
+	}
+
+	t := a.tokens[i]
+	if t.kind != phpTokIdent {
+		return
+	}
+	switch strings.ToLower(t.text) {
+	case "global":
+		global := a.scope
+		if len(a.frames) > 0 {
+			global = a.frames[0].parent
+		}
+		for j := i + 1; j < len(a.tokens) && !a.tokens[j].is(phpTokOp, ";"); j++ {
+			if a.tokens[j].kind == phpTokVariable {
+				a.inherit(global, a.tokens[j].text)
+			}
+		}
+	case "function":
+		j := i + 1
+		for j < len(a.tokens) && !a.tokens[j].is(phpTokOp, "(") && !a.tokens[j].is(phpTokOp, ";") {
+			j++
+		}
+		if j >= len(a.tokens) || !a.tokens[j].is(phpTokOp, "(") {
+			return
+		}
+		j = a.matchParen(j) + 1
+		var uses []string
+		if j < len(a.tokens) && a.tokens[j].is(phpTokIdent, "use") {
+			end := a.matchParen(j + 1)
+			for k := j + 1; k < end; k++ {
+				if a.tokens[k].kind == phpTokVariable {
+					uses = append(uses, a.tokens[k].text)
+				}
+			}
+			j = end + 1
+		}
+		// 跳过返回值类型，抽象方法没有函数体
+		for j < len(a.tokens) && !a.tokens[j].is(phpTokOp, "{") && !a.tokens[j].is(phpTokOp, ";") {
+			j++
+		}
+		if j >= len(a.tokens) || !a.tokens[j].is(phpTokOp, "{") {
+			return
+		}
+		parent := a.scope
+		a.frames = append(a.frames, phpFrame{end: a.matchParen(j), parent: parent})
+		a.scope = newPHPScope()
+		for _, name := range uses {
+			a.inherit(parent, name)
+		}
+	}
+}
+
+func (a *phpAnalysis) inherit(from *phpScope, name string) {
+	a.scope.assigned[name] = true
+	if value, ok := from.consts[name]; ok {
+		a.scope.consts[name] = value
+	}
+	if trace := a.varTrace(from, name); trace != nil {
+		a.scope.taint[name] = trace
+	}
+}
+
+func (a *phpAnalysis) varTrace(scope *phpScope, name string) []string {
+	if phpSuperGlobals[name] {
+		return []string{"$" + name}
+	}
+	if trace, ok := scope.taint[name]; ok {
+		return trace
+	}
+	if scope.extracted != nil && !scope.assigned[name] && name != "this" {
+		return appendTrace(scope.extracted, "$"+name)
+	}
+	return nil
+}
+
+func appendTrace(trace []string, node string) []string {
+	if len(trace) >= maxTaintTrace || (len(trace) > 0 && trace[len(trace)-1] == node) {
+		return trace
+	}
+	out := make([]string, len(trace), len(trace)+1)
+	copy(out, trace)
+	return append(out, node)
+}
+
+// 描述外部输入来源，如 $_POST['c']
+func (a *phpAnalysis) describeSource(tokens []phpToken, i int) string {
+	t := tokens[i]
+	end := t.end
+	if i+1 < len(tokens) && tokens[i+1].is(phpTokOp, "[") {
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j].is(phpTokOp, "]") {
+				end = tokens[j].end
+				break
+			}
+		}
+	}
+	if end-t.offset > 64 {
+		end = t.offset + 64
+	}
+	return a.src[t.offset:end]
+}
+
+// 表达式中第一个外部输入的传递路径，不含外部输入时返回nil
+func (a *phpAnalysis) sourceTrace(tokens []phpToken) []string {
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.kind {
+		case phpTokVariable:
+			if t.text == "_SERVER" && !phpServerInput(tokens[i+1:]) {
+				continue
+			}
+			trace := a.varTrace(a.scope, t.text)
+			if trace == nil {
+				continue
+			}
+			if phpSuperGlobals[t.text] {
+				return []string{a.describeSource(tokens, i)}
+			}
+			return trace
+		case phpTokIdent:
+			if i+1 >= len(tokens) || !tokens[i+1].is(phpTokOp, "(") {
+				continue
+			}
+			name := strings.ToLower(t.text)
+			if phpSourceFunctions[name] {
+				return []string{name + "()"}
+			}
+			if phpSanitizers[name] {
+				i = a.skipGroup(tokens, i+1)
+			}
+		case phpTokOp:
+			// (int)$_GET['id']
+			if t.text == "(" && i+3 < len(tokens) && tokens[i+1].kind == phpTokIdent &&
+				phpCasts[strings.ToLower(tokens[i+1].text)] && tokens[i+2].is(phpTokOp, ")") && tokens[i+3].kind == phpTokVariable {
+				i += 3
+				for i+1 < len(tokens) && tokens[i+1].is(phpTokOp, "[") {
+					i = a.skipGroup(tokens, i+1)
+				}
+			}
+		case phpTokString, phpTokBacktick:
+			if strings.Contains(strings.ToLower(t.text), "php://input") {
+				return []string{"php://input"}
+			}
+			if !t.interpolated {
+				continue
+			}
+			for _, m := range phpInterpolatedVarRegex.FindAllStringSubmatchIndex(t.text, -1) {
+				name := t.text[m[2]:m[3]]
+				if name == "_SERVER" && !phpServerInterpolated(t.text[m[1]:]) {
+					continue
+				}
+				if trace := a.varTrace(a.scope, name); trace != nil {
+					return trace
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// $_SERVER之后的下标为常量时只有客户端控制的项是外部输入，整个数组或变量下标仍视为外部输入
+func phpServerInput(rest []phpToken) bool {
+	if len(rest) < 3 || !rest[0].is(phpTokOp, "[") || rest[1].kind != phpTokString || !rest[2].is(phpTokOp, "]") {
+		return true
+	}
+	return phpServerKey(rest[1].text)
+}
+
+// 字符串中的 $_SERVER[HTTP_HOST] 或 {$_SERVER['HTTP_HOST']}
+func phpServerInterpolated(rest string) bool {
+	if !strings.HasPrefix(rest, "[") {
+		return true
+	}
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return true
+	}
+	key := strings.Trim(rest[1:end], `'"`)
+	if strings.HasPrefix(key, "$") {
+		return true
+	}
+	return phpServerKey(key)
+}
+
+func phpServerKey(key string) bool {
+	return strings.HasPrefix(key, "HTTP_") || phpServerInputs[key]
+}
+
+// 按顶层的逗号拆分参数
+func (a *phpAnalysis) splitArgs(args []phpToken) [][]phpToken {
+	var out [][]phpToken
+	depth, start := 0, 0
+	for j, t := range args {
+		switch {
+		case a.isOpenBracket(t):
+			depth++
+		case a.isCloseBracket(t):
+			depth--
+		case depth == 0 && t.is(phpTokOp, ","):
+			out = append(out, args[start:j])
+			start = j + 1
+		}
+	}
+	return append(out, args[start:])
+}
+
+// 跳过tokens[i]处的括号及其内容，返回匹配的右括号位置
+func (a *phpAnalysis) skipGroup(tokens []phpToken, i int) int {
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch {
+		case a.isOpenBracket(tokens[j]):
+			depth++
+		case a.isCloseBracket(tokens[j]):
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+func (a *phpAnalysis) setVar(name string, rhs []phpToken, appendValue bool) {
+	value, ok := a.constValue(rhs)
+	trace := a.sourceTrace(rhs)
+	if appendValue {
+		prev, known := a.scope.consts[name]
+		value, ok = prev+value, ok && known
+		if trace == nil {
+			trace = a.scope.taint[name]
+		}
+	}
+	a.scope.assigned[name] = true
+	if ok {
+		a.scope.consts[name] = value
+	} else {
+		delete(a.scope.consts, name)
+	}
+	if trace != nil {
+		a.scope.taint[name] = appendTrace(trace, "$"+name)
+	} else {
+		delete(a.scope.taint, name)
+	}
+}
+
+// $a = ...、$a .= ...、$a['k'] = ...、list($a, $b) = ...，记录变量的常量值及外部输入的传递路径
+func (a *phpAnalysis) assignment(i int) {
+	t := a.tokens[i]
+	if i > 0 && (a.tokens[i-1].is(phpTokOp, "->") || a.tokens[i-1].is(phpTokOp, "::")) {
+		return
+	}
+
+	if t.kind == phpTokIdent && strings.EqualFold(t.text, "list") {
+		if i+1 >= len(a.tokens) || !a.tokens[i+1].is(phpTokOp, "(") {
+			return
+		}
+		end := a.matchParen(i + 1)
+		if end+1 >= len(a.tokens) || !a.tokens[end+1].is(phpTokOp, "=") {
+			return
+		}
+		rhs := a.tokens[end+2 : a.exprEnd(end+2)]
+		for k := i + 2; k < end; k++ {
+			if a.tokens[k].kind == phpTokVariable {
+				a.setVar(a.tokens[k].text, rhs, false)
+				delete(a.scope.consts, a.tokens[k].text)
+			}
+		}
+		return
+	}
+
+	if t.kind != phpTokVariable || i+1 >= len(a.tokens) {
+		return
+	}
+	j := i + 1
+	element := false
+	for j < len(a.tokens) && a.tokens[j].is(phpTokOp, "[") {
+		j = a.matchParen(j) + 1
+		element = true
+	}
+	if j >= len(a.tokens) || a.tokens[j].kind != phpTokOp {
+		return
+	}
+	op := a.tokens[j].text
+	if op != "=" && op != ".=" {
+		return
+	}
+	rhs := a.tokens[j+1 : a.exprEnd(j+1)]
+
+	if !element {
+		a.setVar(t.text, rhs, op == ".=")
+		return
+	}
+	// 数组元素赋值不会清除数组已有的污点
+	a.scope.assigned[t.text] = true
+	delete(a.scope.consts, t.text)
+	if trace := a.sourceTrace(rhs); trace != nil {
+		a.scope.taint[t.text] = appendTrace(trace, "$"+t.text)
+	}
+}
+
+// foreach ($_GET as $k => $v)
+func (a *phpAnalysis) foreach(i int) {
+	if !strings.EqualFold(a.tokens[i].text, "foreach") || a.tokens[i].kind != phpTokIdent ||
+		i+1 >= len(a.tokens) || !a.tokens[i+1].is(phpTokOp, "(") {
+		return
+	}
+	end := a.matchParen(i + 1)
+	as := -1
+	for k := i + 2; k < end; k++ {
+		if a.tokens[k].kind == phpTokIdent && strings.EqualFold(a.tokens[k].text, "as") {
+			as = k
+			break
+		}
+	}
+	if as < 0 {
+		return
+	}
+	trace := a.sourceTrace(a.tokens[i+2 : as])
+	for k := as + 1; k < end; k++ {
+		name := a.tokens[k].text
+		if a.tokens[k].kind != phpTokVariable {
+			continue
+		}
+		a.scope.assigned[name] = true
+		delete(a.scope.consts, name)
+		if trace != nil {
+			a.scope.taint[name] = appendTrace(trace, "$"+name)
+		} else {
+			delete(a.scope.taint, name)
+		}
+	}
+}
+
+func (a *phpAnalysis) call(i int) {
+	t := a.tokens[i]
+	if t.kind == phpTokBacktick {
+		if trace := a.sourceTrace(a.tokens[i : i+1]); trace != nil {
+			a.addHit(phpTaintExecRule, t.offset, t.end, appendTrace(trace, "``"))
+		}
+		return
+	}
+	if i+1 >= len(a.tokens) || !a.tokens[i+1].is(phpTokOp, "(") {
+		return
+	}
+	if i > 0 {
+		prev := a.tokens[i-1]
+		if prev.is(phpTokOp, "->") || prev.is(phpTokOp, "::") || prev.kind == phpTokIdent && (strings.EqualFold(prev.text, "function") || strings.EqualFold(prev.text, "new")) {
+			return
+		}
+	}
+
+	start := t.offset
+	var name string
+	dynamic := false
+	switch {
+	case t.kind == phpTokIdent:
+		name = t.text
+	case t.kind == phpTokVariable:
+		// 函数名本身来自外部输入，如 $_GET['a']($_POST['b'])
+		if trace := a.sourceTrace(a.tokens[i : i+1]); trace != nil {
+			a.addHit(phpTaintExecRule, start, a.tokens[a.matchParen(i+1)].end, appendTrace(trace, "$"+t.text+"()"))
+			return
+		}
+		value, ok := a.scope.consts[t.text]
+		if !ok {
+			return
+		}
+		name, dynamic = value, true
+	case t.kind == phpTokString:
+		name, dynamic = t.text, true
+	case t.is(phpTokOp, "]"):
+		open := a.matchParenBackward(i)
+		if open <= 0 || a.tokens[open-1].kind != phpTokVariable {
+			return
+		}
+		if trace := a.sourceTrace(a.tokens[open-1 : i+1]); trace != nil {
+			a.addHit(phpTaintExecRule, a.tokens[open-1].offset, a.tokens[a.matchParen(i+1)].end, appendTrace(trace, a.describeSource(a.tokens, open-1)+"()"))
+		}
+		return
+	case t.is(phpTokOp, ")"):
+		// ('sys'.'tem')(...)
+		open := a.matchParenBackward(i)
+		if open < 0 {
+			return
+		}
+		value, ok := a.constValue(a.tokens[open+1 : i])
+		if !ok {
+			return
+		}
+		name, dynamic, start = value, true, a.tokens[open].offset
+	default:
+		return
+	}
+
+	name = strings.ToLower(strings.TrimPrefix(name, "\\"))
+	end := a.matchParen(i + 1)
+	var args []phpToken
+	if end > i+1 {
+		args = a.tokens[i+2 : end]
+	}
+	switch name {
+	case "extract", "parse_str", "import_request_variables":
+		if trace := a.sourceTrace(args); trace != nil && name != "parse_str" {
+			a.scope.extracted = appendTrace(trace, name+"()")
+		}
+		return
+	}
+
+	rule, ok := phpSinkFunctions[name]
+	if !ok {
+		return
+	}
+	if name == "preg_replace" && !a.pregEval(args) {
+		return
+	}
+	checked := args
+	if n, ok := phpSinkArgs[name]; ok {
+		checked = nil
+		if split := a.splitArgs(args); n < len(split) {
+			checked = split[n]
+		}
+	}
+	if trace := a.sourceTrace(checked); trace != nil {
+		a.addHit(rule, start, a.tokens[end].end, appendTrace(trace, name))
+		return
+	}
+	if dynamic {
+		a.addHit(phpDynamicSinkRule, start, a.tokens[end].end, nil)
+	}
+}
+
+// include、require等语言结构
+func (a *phpAnalysis) include(i int) {
+	t := a.tokens[i]
+	if t.kind != phpTokIdent || !phpIncludeKeywords[strings.ToLower(t.text)] {
+		return
+	}
+	end := a.exprEnd(i + 1)
+	if end <= i+1 {
+		return
+	}
+	if trace := a.sourceTrace(a.tokens[i+1 : end]); trace != nil {
+		a.addHit(phpTaintIncludeRule, t.offset, a.tokens[end-1].end, appendTrace(trace, strings.ToLower(t.text)))
+	}
+}
+
+// preg_replace的正则使用了/e修饰符，或正则来自外部输入
+func (a *phpAnalysis) pregEval(args []phpToken) bool {
+	j := 0
+	for j < len(args) && !args[j].is(phpTokOp, ",") {
+		j++
+	}
+	pattern, ok := a.constValue(args[:j])
+	if !ok {
+		return a.sourceTrace(args[:j]) != nil
+	}
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+	closing := pattern[0]
+	switch closing {
+	case '(':
+		closing = ')'
+	case '[':
+		closing = ']'
+	case '{':
+		closing = '}'
+	case '<':
+		closing = '>'
+	}
+	k := strings.LastIndexByte(pattern, closing)
+	return k > 0 && strings.ContainsRune(pattern[k+1:], 'e')
+}
+
+func (a *phpAnalysis) addHit(rule string, start, end int, trace []string) {
+	scored, ok := phpTaintScores[rule]
+	if !ok {
+		scored = 40
+	}
+	a.hits = append(a.hits, MatcherHit{Rule: rule, Snippet: a.src[start:end], Offset: start, Scored: scored, Trace: trace})
+}
+
+func (a *phpAnalysis) constValue(tokens []phpToken) (string, bool) {
+	e := &phpConstEval{a: a, tokens: tokens}
+	value, ok := e.concat()
+	return value, ok && e.pos == len(tokens)
+}
+
+// 对由字符串、数字、常量变量、拼接及解码函数组成的表达式求值
+type phpConstEval struct {
+	a      *phpAnalysis
+	tokens []phpToken
+	pos    int
+}
+
+func (e *phpConstEval) peek(kind int, text string) bool {
+	return e.pos < len(e.tokens) && e.tokens[e.pos].is(kind, text)
+}
+
+func (e *phpConstEval) concat() (string, bool) {
+	value, ok := e.term()
+	for ok && e.peek(phpTokOp, ".") {
+		e.pos++
+		var next string
+		next, ok = e.term()
+		value += next
+	}
+	return value, ok
+}
+
+func (e *phpConstEval) term() (string, bool) {
+	if e.pos >= len(e.tokens) {
+		return "", false
+	}
+	t := e.tokens[e.pos]
+	e.pos++
+	switch t.kind {
+	case phpTokString:
+		if t.interpolated && phpInterpolatedVarRegex.MatchString(t.text) {
+			return "", false
+		}
+		return t.text, true
+	case phpTokNumber:
+		return t.text, true
+	case phpTokVariable:
+		value, ok := e.a.scope.consts[t.text]
+		return value, ok
+	case phpTokOp:
+		switch t.text {
+		case "@":
+			return e.term()
+		case "(":
+			value, ok := e.concat()
+			if !ok || !e.peek(phpTokOp, ")") {
+				return "", false
+			}
+			e.pos++
+			return value, true
+		}
+	case phpTokIdent:
+		if !e.peek(phpTokOp, "(") {
+			return "", false
+		}
+		e.pos++
+		var args []string
+		for !e.peek(phpTokOp, ")") {
+			arg, ok := e.concat()
+			if !ok {
+				return "", false
+			}
+			args = append(args, arg)
+			if e.peek(phpTokOp, ",") {
+				e.pos++
+			}
+		}
+		e.pos++
+		return phpConstCall(strings.ToLower(t.text), args)
+	}
+	return "", false
+}
+
+func phpConstCall(name string, args []string) (string, bool) {
+	switch {
+	case name == "chr" && len(args) == 1:
+		n, err := strconv.ParseInt(args[0], 0, 64)
+		if err != nil {
+			return "", false
+		}
+		return string([]byte{byte(n)}), true
+	case name == "strtolower" && len(args) == 1:
+		return strings.ToLower(args[0]), true
+	case name == "strtoupper" && len(args) == 1:
+		return strings.ToUpper(args[0]), true
+	case name == "str_replace" && len(args) == 3 && args[0] != "":
+		return strings.ReplaceAll(args[2], args[0], args[1]), true
+	case name == "pack" && len(args) == 2 && args[0] == "H*":
+		out, err := Hex2Bin([]byte(args[1]))
+		return string(out), err == nil
+	}
+	f, ok := phpDecodeFunctions[name]
+	if !ok || len(args) != 1 {
+		return "", false
+	}
+	out, err := f([]byte(args[0]))
+	return string(out), err == nil
+}
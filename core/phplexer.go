@@ -0,0 +1,312 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	phpTokInlineHTML = iota
+	phpTokOpenTag
+	phpTokCloseTag
+	phpTokVariable // $name，text不含$
+	phpTokIdent
+	phpTokString   // 单引号、双引号、heredoc、nowdoc，text为内容
+	phpTokBacktick // `...`，text为内容
+	phpTokNumber
+	phpTokOp
+)
+
+type phpToken struct {
+	kind   int
+	text   string
+	offset int
+	end    int
+	// 双引号、heredoc及反引号中可以插入变量
+	interpolated bool
+}
+
+func (t phpToken) is(kind int, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func isPHPIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isPHPIdentChar(c byte) bool {
+	return isPHPIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+var phpOperators = []string{
+	"<<=", ">>=", "**=", "...", "<=>", "===", "!==", "??=",
+	".=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "->", "=>", "::", "==", "!=", "<>", "<=", ">=",
+	"&&", "||", "++", "--", "<<", ">>", "**", "??",
+}
+
+// 词法分析PHP代码，忽略注释及空白。内容中没有"<?"时视为纯PHP代码（如解码后的payload）
+func lexPHP(src string) []phpToken {
+	var tokens []phpToken
+	pos := 0
+	inPHP := !strings.Contains(src, "<?")
+
+	for pos < len(src) {
+		if !inPHP {
+			start := pos
+			idx := strings.Index(src[pos:], "<?")
+			if idx < 0 {
+				tokens = append(tokens, phpToken{kind: phpTokInlineHTML, text: src[pos:], offset: pos, end: len(src)})
+				break
+			}
+			if idx > 0 {
+				tokens = append(tokens, phpToken{kind: phpTokInlineHTML, text: src[pos : pos+idx], offset: pos, end: pos + idx})
+			}
+			pos += idx + 2
+			if len(src)-pos >= 3 && strings.EqualFold(src[pos:pos+3], "php") {
+				pos += 3
+			} else if pos < len(src) && src[pos] == '=' {
+				// <?= 等价于 <?php echo
+				pos++
+				tokens = append(tokens, phpToken{kind: phpTokOpenTag, text: "<?php", offset: start + idx, end: pos})
+				tokens = append(tokens, phpToken{kind: phpTokIdent, text: "echo", offset: start + idx, end: pos})
+				inPHP = true
+				continue
+			}
+			tokens = append(tokens, phpToken{kind: phpTokOpenTag, text: "<?php", offset: start + idx, end: pos})
+			inPHP = true
+			continue
+		}
+
+		c := src[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			pos++
+		case strings.HasPrefix(src[pos:], "?>"):
+			tokens = append(tokens, phpToken{kind: phpTokCloseTag, text: "?>", offset: pos, end: pos + 2})
+			// ?>相当于分号
+			tokens = append(tokens, phpToken{kind: phpTokOp, text: ";", offset: pos, end: pos + 2})
+			pos += 2
+			inPHP = false
+		case c == '#' || strings.HasPrefix(src[pos:], "//"):
+			for pos < len(src) && src[pos] != '\n' && !strings.HasPrefix(src[pos:], "?>") {
+				pos++
+			}
+		case strings.HasPrefix(src[pos:], "/*"):
+			end := strings.Index(src[pos+2:], "*/")
+			if end < 0 {
+				pos = len(src)
+			} else {
+				pos += end + 4
+			}
+		case c == '$' && pos+1 < len(src) && isPHPIdentStart(src[pos+1]):
+			start := pos
+			pos++
+			for pos < len(src) && isPHPIdentChar(src[pos]) {
+				pos++
+			}
+			tokens = append(tokens, phpToken{kind: phpTokVariable, text: src[start+1 : pos], offset: start, end: pos})
+		case isPHPIdentStart(c) || (c == '\\' && pos+1 < len(src) && isPHPIdentStart(src[pos+1])):
+			start := pos
+			pos++
+			for pos < len(src) && (isPHPIdentChar(src[pos]) || src[pos] == '\\') {
+				pos++
+			}
+			// 忽略命名空间前缀，\system与system相同
+			name := src[start:pos]
+			if i := strings.LastIndexByte(name, '\\'); i >= 0 {
+				name = name[i+1:]
+			}
+			tokens = append(tokens, phpToken{kind: phpTokIdent, text: name, offset: start, end: pos})
+		case c >= '0' && c <= '9':
+			start := pos
+			for pos < len(src) && (isPHPIdentChar(src[pos]) || src[pos] == '.') {
+				pos++
+			}
+			tokens = append(tokens, phpToken{kind: phpTokNumber, text: src[start:pos], offset: start, end: pos})
+		case c == '\'':
+			text, end := lexPHPSingleQuoted(src, pos)
+			tokens = append(tokens, phpToken{kind: phpTokString, text: text, offset: pos, end: end})
+			pos = end
+		case c == '"' || c == '`':
+			text, end := lexPHPDoubleQuoted(src, pos, c)
+			kind := phpTokString
+			if c == '`' {
+				kind = phpTokBacktick
+			}
+			tokens = append(tokens, phpToken{kind: kind, text: text, offset: pos, end: end, interpolated: true})
+			pos = end
+		case strings.HasPrefix(src[pos:], "<<<"):
+			tok, end, ok := lexPHPHeredoc(src, pos)
+			if ok {
+				tokens = append(tokens, tok)
+				pos = end
+				continue
+			}
+			tokens = append(tokens, phpToken{kind: phpTokOp, text: "<<", offset: pos, end: pos + 2})
+			pos += 2
+		default:
+			op := string(c)
+			for _, o := range phpOperators {
+				if strings.HasPrefix(src[pos:], o) {
+					op = o
+					break
+				}
+			}
+			tokens = append(tokens, phpToken{kind: phpTokOp, text: op, offset: pos, end: pos + len(op)})
+			pos += len(op)
+		}
+	}
+	return tokens
+}
+
+func lexPHPSingleQuoted(src string, pos int) (string, int) {
+	var sb strings.Builder
+	i := pos + 1
+	for i < len(src) {
+		c := src[i]
+		if c == '\'' {
+			return sb.String(), i + 1
+		}
+		if c == '\\' && i+1 < len(src) && (src[i+1] == '\'' || src[i+1] == '\\') {
+			sb.WriteByte(src[i+1])
+			i += 2
+			continue
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return sb.String(), len(src)
+}
+
+func lexPHPDoubleQuoted(src string, pos int, quote byte) (string, int) {
+	i := pos + 1
+	for i < len(src) {
+		c := src[i]
+		if c == quote {
+			return phpUnescape(src[pos+1 : i]), i + 1
+		}
+		if c == '\\' {
+			i += 2
+			continue
+		}
+		i++
+	}
+	return phpUnescape(src[pos+1:]), len(src)
+}
+
+func lexPHPHeredoc(src string, pos int) (phpToken, int, bool) {
+	i := pos + 3
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	nowdoc := false
+	quote := byte(0)
+	if i < len(src) && (src[i] == '\'' || src[i] == '"') {
+		quote = src[i]
+		nowdoc = quote == '\''
+		i++
+	}
+	start := i
+	for i < len(src) && isPHPIdentChar(src[i]) {
+		i++
+	}
+	label := src[start:i]
+	if label == "" {
+		return phpToken{}, 0, false
+	}
+	if quote != 0 {
+		if i >= len(src) || src[i] != quote {
+			return phpToken{}, 0, false
+		}
+		i++
+	}
+	nl := strings.IndexByte(src[i:], '\n')
+	if nl < 0 {
+		return phpToken{}, 0, false
+	}
+	bodyStart := i + nl + 1
+
+	// 结束标记位于行首（允许缩进），其后不能紧跟标识符字符
+	lineStart := bodyStart
+	for lineStart <= len(src) {
+		lineEnd := strings.IndexByte(src[lineStart:], '\n')
+		line := src[lineStart:]
+		if lineEnd >= 0 {
+			line = src[lineStart : lineStart+lineEnd]
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, label) && (len(trimmed) == len(label) || !isPHPIdentChar(trimmed[len(label)])) {
+			body := ""
+			if lineStart > bodyStart {
+				body = src[bodyStart : lineStart-1]
+			}
+			end := lineStart + (len(line) - len(trimmed)) + len(label)
+			if nowdoc {
+				return phpToken{kind: phpTokString, text: body, offset: pos, end: end}, end, true
+			}
+			return phpToken{kind: phpTokString, text: phpUnescape(body), offset: pos, end: end, interpolated: true}, end, true
+		}
+		if lineEnd < 0 {
+			break
+		}
+		lineStart += lineEnd + 1
+	}
+	return phpToken{}, 0, false
+}
+
+// 处理双引号字符串、heredoc及反引号中的转义字符，变量插值保持原样
+func phpUnescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		e := s[i+1]
+		switch e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'e':
+			sb.WriteByte(0x1b)
+		case '"', '\\', '$', '`':
+			sb.WriteByte(e)
+		case 'x':
+			end := i + 2
+			for end < len(s) && end < i+4 && strings.IndexByte("0123456789abcdefABCDEF", s[end]) >= 0 {
+				end++
+			}
+			v, err := strconv.ParseUint(s[i+2:end], 16, 8)
+			if err != nil {
+				sb.WriteString("\\x")
+				break
+			}
+			sb.WriteByte(byte(v))
+			i = end - 2
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i + 1
+			for end < len(s) && end < i+4 && s[end] >= '0' && s[end] <= '7' {
+				end++
+			}
+			v, _ := strconv.ParseUint(s[i+1:end], 8, 16)
+			sb.WriteByte(byte(v))
+			i = end - 2
+		default:
+			sb.WriteByte(c)
+			sb.WriteByte(e)
+		}
+		i++
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package core
+
+import "regexp"
+
+const (
+	PYTHON = "python"
+)
+
+var python = &Plugin{
+	Name: PYTHON,
+	Desc: "A plugin that detects webshell of python type",
+	Decoders: []Decoder{
+		{
+			Name:       "python/base64_decode",
+			Regex:      regexp.MustCompile(`base64\.(?:b64decode|decodestring|decodebytes)\s*\(\s*[bBuU]?['"][A-Za-z0-9+\/=]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][A-Za-z0-9+\/=]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		}, {
+			Name:       "python/zlib_base64_decode",
+			Regex:      regexp.MustCompile(`zlib\.decompress\s*\(\s*base64\.b64decode\s*\(\s*[bBuU]?['"][A-Za-z0-9+\/=]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][A-Za-z0-9+\/=]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64, ZlibUncompress},
+		}, {
+			Name:       "python/hex_decode",
+			Regex:      regexp.MustCompile(`(?:bytes\.fromhex|binascii\.(?:unhexlify|a2b_hex))\s*\(\s*[bBuU]?['"][0-9a-fA-F]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][0-9a-fA-F]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{Hex2Bin},
+		}, {
+			Name:       "python/rot13",
+			Regex:      regexp.MustCompile(`codecs\.decode\s*\(\s*['"][^'"]+['"]\s*,\s*['"]rot_?13['"]`),
+			DataFilter: regexp.MustCompile(`\(\s*['"][^'"]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`^\(\s*['"]|['"]$`, "", -1}},
+			},
+			Functions: []BaseFunc{Rot13},
+		}, {
+			// ''.join(chr(c) for c in [101, 118, 97, 108])、''.join(map(chr, [...]))
+			Name:       "python/chr_join",
+			Regex:      regexp.MustCompile(`\.join\s*\(\s*(?:map\s*\(\s*chr\s*,\s*|chr\s*\(\s*\w+\s*\)\s*for\s+\w+\s+in\s+)[\[(][\d\s,]+[\])]`),
+			DataFilter: regexp.MustCompile(`[\[(][\d\s,]+[\])]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`[\[\]()\s]`, "", -1}},
+				{Func: StringReplace, Arguments: []interface{}{",", "|", -1}},
+			},
+			Functions: []BaseFunc{CharDecode},
+		},
+	},
+	Tags: []Tag{
+		{Name: "python/exec_compile", Regex: regexp.MustCompile(`\bexec\s*\(\s*compile\s*\(`), Scored: 60},
+		{Name: "python/exec_decoded", Regex: regexp.MustCompile(`\b(?:exec|eval)\s*\(\s*(?:zlib\.decompress|base64\.b64decode|marshal\.loads|codecs\.decode|bytes\.fromhex|binascii\.unhexlify)\s*\(`), Scored: 70},
+		{Name: "python/marshal_loads", Regex: regexp.MustCompile(`marshal\.loads\s*\(`), Scored: 50},
+		{Name: "python/zlib_base64", Regex: regexp.MustCompile(`zlib\.decompress\s*\(\s*base64\.b64decode\s*\(`), Scored: 40},
+		{Name: "python/pty_spawn", Regex: regexp.MustCompile(`pty\.spawn\s*\(\s*['"](?:/bin/)?(?:ba|z)?sh['"]`), Scored: 70},
+		{Name: "python/reverse_shell", Regex: regexp.MustCompile(`os\.dup2\s*\(\s*\w+\.fileno\s*\(\s*\)\s*,\s*\w+\s*\)`), Scored: 60},
+		{Name: "python/cgi_command", Regex: regexp.MustCompile(`(?s)(?:cgi\.FieldStorage\s*\(|request\.(?:args|form|values)).{0,300}?(?:os\.(?:system|popen)|subprocess\.(?:Popen|call|check_output|run|getoutput)|commands\.getoutput)\s*\(`), Scored: 60},
+		{Name: "python/command", Regex: regexp.MustCompile(`(?:os\.(?:system|popen|exec[lv]p?e?)|subprocess\.(?:Popen|call|check_output|getoutput|run)|commands\.getoutput)\s*\(`), Scored: 15, Repeat: true},
+		{Name: "python/download", Regex: regexp.MustCompile(`urllib(?:\.request)?\.urlretrieve\s*\(`), Scored: 12, Repeat: true},
+		{Name: "python/dynamic_import", Regex: regexp.MustCompile(`__import__\s*\(\s*['"](?:os|subprocess|pty|socket|commands)['"]\s*\)`), Scored: 30},
+	},
+	Supports: []string{"py", "pyw", "cgi"},
+}
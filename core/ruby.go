@@ -0,0 +1,47 @@
+package core
+
+import "regexp"
+
+const (
+	RUBY = "ruby"
+)
+
+var ruby = &Plugin{
+	Name: RUBY,
+	Desc: "A plugin that detects webshell of ruby type",
+	Decoders: []Decoder{
+		{
+			Name:       "ruby/base64_decode",
+			Regex:      regexp.MustCompile(`Base64\.(?:decode64|strict_decode64)\s*\(?\s*['"][A-Za-z0-9+\/=\s]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][A-Za-z0-9+\/=\s]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"\s]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		}, {
+			// "ZXZhbA==".unpack("m")
+			Name:       "ruby/unpack_m",
+			Regex:      regexp.MustCompile(`['"][A-Za-z0-9+\/=]+['"]\.unpack1?\s*\(?\s*['"]m0?['"]`),
+			DataFilter: regexp.MustCompile(`^['"][A-Za-z0-9+\/=]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64},
+		}, {
+			Name:       "ruby/zlib_base64_decode",
+			Regex:      regexp.MustCompile(`Zlib::Inflate\.inflate\s*\(\s*Base64\.decode64\s*\(\s*['"][A-Za-z0-9+\/=]+['"]`),
+			DataFilter: regexp.MustCompile(`['"][A-Za-z0-9+\/=]+['"]`),
+			PreDecodeActions: []Action{
+				{Func: StringReplaceWithRegex, Arguments: []interface{}{`['"]`, "", -1}},
+			},
+			Functions: []BaseFunc{DecodeBase64, ZlibUncompress},
+		},
+	},
+	Tags: []Tag{
+		{Name: "ruby/eval_input", Regex: regexp.MustCompile("(?:\\b(?:eval|instance_eval|class_eval|system|exec|spawn)|IO\\.popen|Open3\\.\\w+|`)\\s*\\(?\\s*(?:params|request\\.(?:params|query_string|body\\.read)|cookies)\\b"), Scored: 80},
+		{Name: "ruby/eval_decoded", Regex: regexp.MustCompile(`\beval\s*\(?\s*(?:Base64\.(?:decode64|strict_decode64)|Zlib::Inflate|['"][A-Za-z0-9+\/=]+['"]\.unpack)`), Scored: 70},
+		{Name: "ruby/reverse_shell", Regex: regexp.MustCompile(`(?s)TCPSocket\.(?:new|open)\s*\(.{0,200}?(?:/bin/(?:ba)?sh|\bexec\b|IO\.popen|\bspawn\b)`), Scored: 70},
+		{Name: "ruby/command", Regex: regexp.MustCompile(`(?:\bsystem\s*\(|\bIO\.popen\s*\(|%x[{(\[]|Open3\.(?:popen[23]|capture[23]e?)|\bexec\s*\()`), Scored: 15, Repeat: true},
+	},
+	Supports: []string{"rb", "erb"},
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+)
+
+// 规则文件格式，YAML与JSON均可，JSON可视为YAML的子集
+//
+//	plugins:
+//	  - name: php                # 与内置插件同名时追加到该插件
+//	    desc: ...
+//	    supports: [php]
+//	    tags:
+//	      - {name: php/intel_1, regex: '...', scored: 50, repeat: false}
+//	    decoders:
+//	      - name: php/intel_rot13
+//	        regex: '...'
+//	        data_filter: '...'
+//	        pre_decode_actions:
+//	          - {func: StringReplace, args: ["'", "", -1]}
+//	        post_decode_actions: []
+//	        functions: [DecodeBase64, GzInflate]
+type RuleFile struct {
+	Plugins []RulePlugin `yaml:"plugins"`
+}
+
+type RulePlugin struct {
+	Name     string        `yaml:"name"`
+	Desc     string        `yaml:"desc"`
+	Supports []string      `yaml:"supports"`
+	Tags     []RuleTag     `yaml:"tags"`
+	Decoders []RuleDecoder `yaml:"decoders"`
+}
+
+type RuleTag struct {
+	Name   string  `yaml:"name"`
+	Regex  string  `yaml:"regex"`
+	Scored float64 `yaml:"scored"`
+	Repeat bool    `yaml:"repeat"`
+}
+
+type RuleDecoder struct {
+	Name              string       `yaml:"name"`
+	Regex             string       `yaml:"regex"`
+	DataFilter        string       `yaml:"data_filter"`
+	PreDecodeActions  []RuleAction `yaml:"pre_decode_actions"`
+	PostDecodeActions []RuleAction `yaml:"post_decode_actions"`
+	Functions         []string     `yaml:"functions"`
+}
+
+type RuleAction struct {
+	Func string        `yaml:"func"`
+	Args []interface{} `yaml:"args"`
+}
+
+type funcSpec struct {
+	Func    BaseFunc
+	Args    []reflect.Kind
+	MinArgs int
+}
+
+// 规则文件中可以引用的函数及其参数类型
+var baseFuncs = map[string]funcSpec{
+	"DecodeBase64":           {Func: DecodeBase64},
+	"GzInflate":              {Func: GzInflate},
+	"UrlDecode":              {Func: UrlDecode},
+	"CharDecode":             {Func: CharDecode},
+	"ZlibUncompress":         {Func: ZlibUncompress},
+	"GzDecode":               {Func: GzDecode},
+	"Rot13":                  {Func: Rot13},
+	"StringReverse":          {Func: StringReverse},
+	"Hex2Bin":                {Func: Hex2Bin},
+	"UUDecode":               {Func: UUDecode},
+	"PHPCallChain":           {Func: PHPCallChain},
+	"UnicodeUnescape":        {Func: UnicodeUnescape},
+	"JavaClassStrings":       {Func: JavaClassStrings},
+	"ScriptDecode":           {Func: ScriptDecode},
+	"JSUnescape":             {Func: JSUnescape},
+	"JSUnpack":               {Func: JSUnpack},
+	"StringReplace":          {Func: StringReplace, Args: []reflect.Kind{reflect.String, reflect.String, reflect.Int}, MinArgs: 3},
+	"StringReplaceWithRegex": {Func: StringReplaceWithRegex, Args: []reflect.Kind{reflect.String, reflect.String, reflect.Int}, MinArgs: 2},
+}
+
+func LoadRules(path string) ([]*Plugin, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules %s error: %v", path, err)
+	}
+	plugins, err := ParseRules(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return plugins, nil
+}
+
+func ParseRules(content []byte) ([]*Plugin, error) {
+	var rf RuleFile
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rf); err != nil {
+		return nil, fmt.Errorf("unmarshal rules error: %v", err)
+	}
+
+	var plugins []*Plugin
+	for pi, rp := range rf.Plugins {
+		if rp.Name == "" {
+			return nil, fmt.Errorf("plugins[%d]: name is required", pi)
+		}
+		plugin := &Plugin{
+			Name:     rp.Name,
+			Desc:     rp.Desc,
+			Supports: rp.Supports,
+		}
+		for ti, rt := range rp.Tags {
+			tag, err := compileTag(rt)
+			if err != nil {
+				return nil, fmt.Errorf("plugins[%d].tags[%d] (%s): %v", pi, ti, rt.Name, err)
+			}
+			plugin.Tags = append(plugin.Tags, tag)
+		}
+		for di, rd := range rp.Decoders {
+			decoder, err := compileDecoder(rd)
+			if err != nil {
+				return nil, fmt.Errorf("plugins[%d].decoders[%d] (%s): %v", pi, di, rd.Name, err)
+			}
+			plugin.Decoders = append(plugin.Decoders, decoder)
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	return plugins, nil
+}
+
+func compileTag(rt RuleTag) (Tag, error) {
+	if rt.Name == "" {
+		return Tag{}, fmt.Errorf("name is required")
+	}
+	regex, err := compileRegex("regex", rt.Regex)
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{Name: rt.Name, Regex: regex, Scored: rt.Scored, Repeat: rt.Repeat}, nil
+}
+
+func compileDecoder(rd RuleDecoder) (Decoder, error) {
+	if rd.Name == "" {
+		return Decoder{}, fmt.Errorf("name is required")
+	}
+	regex, err := compileRegex("regex", rd.Regex)
+	if err != nil {
+		return Decoder{}, err
+	}
+	dataFilter, err := compileRegex("data_filter", rd.DataFilter)
+	if err != nil {
+		return Decoder{}, err
+	}
+
+	d := Decoder{
+		Name:       rd.Name,
+		Regex:      regex,
+		DataFilter: dataFilter,
+		Functions:  []BaseFunc{},
+	}
+	if d.PreDecodeActions, err = compileActions("pre_decode_actions", rd.PreDecodeActions); err != nil {
+		return Decoder{}, err
+	}
+	if d.PostDecodeActions, err = compileActions("post_decode_actions", rd.PostDecodeActions); err != nil {
+		return Decoder{}, err
+	}
+	for i, name := range rd.Functions {
+		spec, ok := baseFuncs[name]
+		if !ok {
+			return Decoder{}, fmt.Errorf("functions[%d]: unknown function %q", i, name)
+		}
+		if spec.MinArgs > 0 {
+			return Decoder{}, fmt.Errorf("functions[%d]: %s requires arguments, use it as an action", i, name)
+		}
+		d.Functions = append(d.Functions, spec.Func)
+	}
+	return d, nil
+}
+
+func compileRegex(field, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("%s is required", field)
+	}
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", field, err)
+	}
+	return regex, nil
+}
+
+func compileActions(field string, ras []RuleAction) ([]Action, error) {
+	var actions []Action
+	for i, ra := range ras {
+		spec, ok := baseFuncs[ra.Func]
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: unknown function %q", field, i, ra.Func)
+		}
+		if len(ra.Args) < spec.MinArgs || len(ra.Args) > len(spec.Args) {
+			return nil, fmt.Errorf("%s[%d]: %s expects %d to %d arguments, got %d", field, i, ra.Func, spec.MinArgs, len(spec.Args), len(ra.Args))
+		}
+
+		args := make([]interface{}, len(ra.Args))
+		for ai, arg := range ra.Args {
+			v, err := convertArgument(arg, spec.Args[ai])
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %s argument %d: %v", field, i, ra.Func, ai+1, err)
+			}
+			args[ai] = v
+		}
+		if ra.Func == "StringReplaceWithRegex" {
+			if _, err := regexp.Compile(args[0].(string)); err != nil {
+				return nil, fmt.Errorf("%s[%d]: %s argument 1: invalid regex: %v", field, i, ra.Func, err)
+			}
+		}
+
+		actions = append(actions, Action{Func: spec.Func, Arguments: args})
+	}
+	return actions, nil
+}
+
+func convertArgument(arg interface{}, kind reflect.Kind) (interface{}, error) {
+	switch kind {
+	case reflect.String:
+		if s, ok := arg.(string); ok {
+			return s, nil
+		}
+	case reflect.Int:
+		switch v := arg.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("expects %s, got %T (%v)", kind, arg, arg)
+}
+
+// 合并规则文件中的插件，与已有插件同名时追加其Tags、Decoders、Matchers及Supports，不会修改传入的插件
+func MergePlugins(base []*Plugin, extra []*Plugin) []*Plugin {
+	var merged []*Plugin
+	index := make(map[string]int)
+	for _, p := range base {
+		cp := *p
+		cp.Tags = append([]Tag{}, p.Tags...)
+		cp.Decoders = append([]Decoder{}, p.Decoders...)
+		cp.Matchers = append([]Matcher{}, p.Matchers...)
+		index[cp.Name] = len(merged)
+		merged = append(merged, &cp)
+	}
+	for _, p := range extra {
+		if i, ok := index[p.Name]; ok {
+			mp := merged[i]
+			mp.Tags = append(mp.Tags, p.Tags...)
+			mp.Decoders = append(mp.Decoders, p.Decoders...)
+			mp.Matchers = append(mp.Matchers, p.Matchers...)
+			// Supports为空的插件适用于所有文件，不需要追加
+			if len(mp.Supports) > 0 {
+				supports := append([]string{}, mp.Supports...)
+				for _, ext := range p.Supports {
+					if !hasElement(supports, ext) {
+						supports = append(supports, ext)
+					}
+				}
+				mp.Supports = supports
+			}
+			if p.Desc != "" {
+				mp.Desc = p.Desc
+			}
+			continue
+		}
+		cp := *p
+		cp.Tags = append([]Tag{}, p.Tags...)
+		cp.Decoders = append([]Decoder{}, p.Decoders...)
+		cp.Matchers = append([]Matcher{}, p.Matchers...)
+		index[cp.Name] = len(merged)
+		merged = append(merged, &cp)
+	}
+	return merged
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Windows Script Encoder（screnc）编码后的脚本形如 #@~^XXXXXX==<编码内容>XXXXXX==^#~@
+const (
+	scriptEncodeStart = "#@~^"
+	scriptEncodeEnd   = "^#~@"
+)
+
+// 编码内容中的转义，@&表示换行
+var scriptUnescapes = map[byte]byte{'&': '\n', '#': '\r', '*': '>', '!': '<', '$': '@'}
+
+var scriptEscapes = map[byte]string{'\n': "@&", '\r': "@#", '>': "@*", '<': "@!", '@': "@$"}
+
+// 解码表，下标为编码后的字符，三列分别对应三种替换方式，\n \r < > @ 以转义形式出现，不在表中
+var scriptDecodeTable = map[byte][3]byte{
+	0x09: {0x57, 0x6e, 0x7b}, 0x20: {0x2e, 0x2d, 0x32}, 0x21: {0x47, 0x75, 0x30}, 0x22: {0x7a, 0x52, 0x21},
+	0x23: {0x56, 0x60, 0x29}, 0x24: {0x42, 0x71, 0x5b}, 0x25: {0x6a, 0x5e, 0x38}, 0x26: {0x2f, 0x49, 0x33},
+	0x27: {0x26, 0x5c, 0x3d}, 0x28: {0x49, 0x62, 0x58}, 0x29: {0x41, 0x7d, 0x3a}, 0x2a: {0x34, 0x29, 0x35},
+	0x2b: {0x32, 0x36, 0x65}, 0x2c: {0x5b, 0x20, 0x39}, 0x2d: {0x76, 0x7c, 0x5c}, 0x2e: {0x72, 0x7a, 0x56},
+	0x2f: {0x43, 0x7f, 0x73}, 0x30: {0x38, 0x6b, 0x66}, 0x31: {0x39, 0x63, 0x4e}, 0x32: {0x70, 0x33, 0x45},
+	0x33: {0x45, 0x2b, 0x6b}, 0x34: {0x68, 0x68, 0x62}, 0x35: {0x71, 0x51, 0x59}, 0x36: {0x4f, 0x66, 0x78},
+	0x37: {0x09, 0x76, 0x5e}, 0x38: {0x62, 0x31, 0x7d}, 0x39: {0x44, 0x64, 0x4a}, 0x3a: {0x23, 0x54, 0x6d},
+	0x3b: {0x75, 0x43, 0x71}, 0x3d: {0x7e, 0x3a, 0x60}, 0x3f: {0x5e, 0x7e, 0x53}, 0x41: {0x77, 0x45, 0x42},
+	0x42: {0x4a, 0x2c, 0x27}, 0x43: {0x61, 0x2a, 0x48}, 0x44: {0x5d, 0x74, 0x72}, 0x45: {0x22, 0x27, 0x75},
+	0x46: {0x4b, 0x37, 0x31}, 0x47: {0x6f, 0x44, 0x37}, 0x48: {0x4e, 0x79, 0x4d}, 0x49: {0x3b, 0x59, 0x52},
+	0x4a: {0x4c, 0x2f, 0x22}, 0x4b: {0x50, 0x6f, 0x54}, 0x4c: {0x67, 0x26, 0x6a}, 0x4d: {0x2a, 0x72, 0x47},
+	0x4e: {0x7d, 0x6a, 0x64}, 0x4f: {0x74, 0x39, 0x2d}, 0x50: {0x54, 0x7b, 0x20}, 0x51: {0x2b, 0x3f, 0x7f},
+	0x52: {0x2d, 0x38, 0x2e}, 0x53: {0x2c, 0x77, 0x4c}, 0x54: {0x30, 0x67, 0x5d}, 0x55: {0x6e, 0x53, 0x7e},
+	0x56: {0x6b, 0x47, 0x6c}, 0x57: {0x66, 0x34, 0x6f}, 0x58: {0x35, 0x78, 0x79}, 0x59: {0x25, 0x5d, 0x74},
+	0x5a: {0x21, 0x30, 0x43}, 0x5b: {0x64, 0x23, 0x26}, 0x5c: {0x4d, 0x5a, 0x76}, 0x5d: {0x52, 0x5b, 0x25},
+	0x5e: {0x63, 0x6c, 0x24}, 0x5f: {0x3f, 0x48, 0x2b}, 0x60: {0x7b, 0x55, 0x28}, 0x61: {0x78, 0x70, 0x23},
+	0x62: {0x29, 0x69, 0x41}, 0x63: {0x28, 0x2e, 0x34}, 0x64: {0x73, 0x4c, 0x09}, 0x65: {0x59, 0x21, 0x2a},
+	0x66: {0x33, 0x24, 0x44}, 0x67: {0x7f, 0x4e, 0x3f}, 0x68: {0x6d, 0x50, 0x77}, 0x69: {0x55, 0x09, 0x3b},
+	0x6a: {0x53, 0x56, 0x55}, 0x6b: {0x7c, 0x73, 0x69}, 0x6c: {0x3a, 0x35, 0x61}, 0x6d: {0x5f, 0x61, 0x63},
+	0x6e: {0x65, 0x4b, 0x50}, 0x6f: {0x46, 0x58, 0x67}, 0x70: {0x58, 0x3b, 0x51}, 0x71: {0x31, 0x57, 0x49},
+	0x72: {0x69, 0x22, 0x4f}, 0x73: {0x6c, 0x6d, 0x46}, 0x74: {0x5a, 0x4d, 0x68}, 0x75: {0x48, 0x25, 0x7c},
+	0x76: {0x27, 0x28, 0x36}, 0x77: {0x5c, 0x46, 0x70}, 0x78: {0x3d, 0x4a, 0x6e}, 0x79: {0x24, 0x32, 0x7a},
+	0x7a: {0x79, 0x41, 0x2f}, 0x7b: {0x37, 0x3d, 0x5f}, 0x7c: {0x60, 0x5f, 0x4b}, 0x7d: {0x51, 0x4f, 0x5a},
+	0x7e: {0x20, 0x42, 0x2c}, 0x7f: {0x36, 0x65, 0x57},
+}
+
+// 第i个ASCII字符使用的替换方式，64个一循环
+var scriptDecodePattern = [64]byte{
+	0, 1, 2, 0, 1, 2, 1, 2, 2, 1, 2, 1, 0, 2, 1, 2, 0, 2, 1, 2, 0, 0, 1, 2, 2, 1, 0, 2, 1, 2, 2, 1,
+	0, 0, 2, 1, 2, 1, 2, 0, 2, 0, 0, 1, 2, 0, 2, 1, 0, 2, 1, 2, 0, 0, 1, 2, 2, 0, 0, 1, 2, 0, 2, 1,
+}
+
+// 编码表，由解码表反推
+var scriptEncodeTables = func() [3]map[byte]byte {
+	var tables [3]map[byte]byte
+	for i := range tables {
+		tables[i] = make(map[byte]byte, len(scriptDecodeTable))
+	}
+	for encoded, row := range scriptDecodeTable {
+		for i, plain := range row {
+			tables[i][plain] = encoded
+		}
+	}
+	return tables
+}()
+
+// 头部及尾部的长度与校验和为小端序uint32的base64编码，只取前6个字符，后接"=="
+func decodeScriptNumber(s string) (uint32, bool) {
+	if len(s) != 8 || s[6:] != "==" {
+		return 0, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b), true
+}
+
+func encodeScriptNumber(n uint32) string {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func decodeScriptBody(body string) string {
+	out := make([]byte, 0, len(body))
+	index := 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		// 非ASCII字符不编码，也不参与计数
+		if c >= 0x80 {
+			out = append(out, c)
+			continue
+		}
+		if c == '@' && i+1 < len(body) {
+			if u, ok := scriptUnescapes[body[i+1]]; ok {
+				out = append(out, u)
+				index++
+				i++
+				continue
+			}
+		}
+		if row, ok := scriptDecodeTable[c]; ok {
+			c = row[scriptDecodePattern[index%64]]
+		}
+		out = append(out, c)
+		index++
+	}
+	return string(out)
+}
+
+// 解析从s开头的编码块，返回解码结果及块的长度。优先按头部记录的长度定位结尾，长度不符时查找结束标记
+func decodeScriptBlock(s string) (string, int, bool) {
+	header := len(scriptEncodeStart) + 8
+	if len(s) < header+8+len(scriptEncodeEnd) {
+		return "", 0, false
+	}
+	n, ok := decodeScriptNumber(s[len(scriptEncodeStart):header])
+	if !ok {
+		return "", 0, false
+	}
+	// 尾部的校验和不影响解码，不做校验
+	if end := header + int(n); n < uint32(len(s)) && end+8+len(scriptEncodeEnd) <= len(s) &&
+		s[end+6:end+8] == "==" && strings.HasPrefix(s[end+8:], scriptEncodeEnd) {
+		return decodeScriptBody(s[header:end]), end + 8 + len(scriptEncodeEnd), true
+	}
+	end := strings.Index(s[header:], scriptEncodeEnd)
+	if end < 8 {
+		return "", 0, false
+	}
+	return decodeScriptBody(s[header : header+end-8]), header + end + len(scriptEncodeEnd), true
+}
+
+// 还原Windows Script Encoder（VBScript.Encode、JScript.Encode）编码的脚本，内容中的每个 #@~^...^#~@ 块
+// 替换为解码后的代码，其余内容保持不变，以便标签可以结合上下文匹配
+var ScriptDecode BaseFunc = func(in []byte, args ...interface{}) ([]byte, error) {
+	s := string(in)
+	var sb strings.Builder
+	decoded := 0
+	for {
+		i := strings.Index(s, scriptEncodeStart)
+		if i < 0 {
+			break
+		}
+		sb.WriteString(s[:i])
+		script, n, ok := decodeScriptBlock(s[i:])
+		if !ok {
+			sb.WriteString(scriptEncodeStart)
+			s = s[i+len(scriptEncodeStart):]
+			continue
+		}
+		sb.WriteString(script)
+		s = s[i+n:]
+		decoded++
+	}
+	if decoded == 0 {
+		return nil, fmt.Errorf("[ScriptDecode] Encoded block not found\n")
+	}
+	sb.WriteString(s)
+	return []byte(sb.String()), nil
+}
+
+// 按screnc的格式编码脚本，与ScriptDecode互逆，用于生成编码后的样本
+func ScriptEncode(script string) string {
+	var body strings.Builder
+	var checksum uint32
+	index := 0
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if c >= 0x80 {
+			body.WriteByte(c)
+			continue
+		}
+		checksum += uint32(c)
+		if e, ok := scriptEscapes[c]; ok {
+			body.WriteString(e)
+		} else if e, ok := scriptEncodeTables[scriptDecodePattern[index%64]][c]; ok {
+			body.WriteByte(e)
+		} else {
+			body.WriteByte(c)
+		}
+		index++
+	}
+	return scriptEncodeStart + encodeScriptNumber(uint32(body.Len())) + body.String() + encodeScriptNumber(checksum) + scriptEncodeEnd
+}
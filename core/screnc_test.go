@@ -0,0 +1,73 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// sample/webshell/screnc中的样本由ScriptEncode生成，解码后除language中的.Encode外与明文一致。
+// 编码与解码使用同一套编码表，只能说明两者一致，编码表是否与screnc相同由TestScriptDecodeScrenc验证
+func TestScriptEncodeRoundTrip(t *testing.T) {
+	dir := filepath.Join("..", "sample", "webshell", "screnc")
+	tests := []struct {
+		plain, encoded string
+	}{
+		{"cmd.asp", "cmd.vbscript_encode.asp"},
+		{"cmd_js.asp", "cmd_js.jscript_encode.asp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			plain := readTestFile(t, filepath.Join(dir, tt.plain))
+			encoded := readTestFile(t, filepath.Join(dir, tt.encoded))
+			decoded, err := ScriptDecode([]byte(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.NewReplacer("VBScript.Encode", "VBScript", "JScript.Encode", "JScript").Replace(string(decoded))
+			if strings.TrimSpace(got) != strings.TrimSpace(plain) {
+				t.Errorf("decoded %s:\n%s\nwant %s:\n%s", tt.encoded, got, tt.plain, plain)
+			}
+		})
+	}
+}
+
+// testdata/screnc中screnc.exe的输出（.vbe、.jse或.asp）解码后与同名加.txt后缀的明文比较，
+// 与上面由ScriptEncode生成的样本不同，这些文件可以发现编码表与screnc不一致的问题
+func TestScriptDecodeScrenc(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"*.vbe", "*.jse", "*.asp"} {
+		matches, err := filepath.Glob(filepath.Join("testdata", "screnc", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Skip("no screnc.exe output in testdata/screnc, see testdata/screnc/README.md")
+	}
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			plain := readTestFile(t, path+".txt")
+			encoded := readTestFile(t, path)
+			decoded, err := ScriptDecode([]byte(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.NewReplacer("VBScript.Encode", "VBScript", "JScript.Encode", "JScript").Replace(string(decoded))
+			if got != plain {
+				t.Errorf("decoded %s:\n%q\nwant:\n%q", path, got, plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package core
+
+import "regexp"
+
+const (
+	SHELL = "shell"
+)
+
+var shell = &Plugin{
+	Name: SHELL,
+	Desc: "A plugin that detects webshell of shell or cgi script type",
+	Decoders: []Decoder{
+		{
+			// echo ... | base64 -d、base64 -d <<< ...
+			Name:       "shell/base64_decode",
+			Regex:      regexp.MustCompile(`(?:echo\s+(?:-n\s+)?['"]?[A-Za-z0-9+\/=]{8,}['"]?\s*\|\s*base64\s+(?:-d|--decode|-D)|base64\s+(?:-d|--decode|-D)\s*<<<\s*['"]?[A-Za-z0-9+\/=]{8,})`),
+			DataFilter: regexp.MustCompile(`[A-Za-z0-9+\/=]{8,}`),
+			Functions:  []BaseFunc{DecodeBase64},
+		}, {
+			Name:       "shell/hex_decode",
+			Regex:      regexp.MustCompile(`echo\s+(?:-n\s+)?['"]?[0-9a-fA-F]{8,}['"]?\s*\|\s*xxd\s+-r\s+-p`),
+			DataFilter: regexp.MustCompile(`[0-9a-fA-F]{8,}`),
+			Functions:  []BaseFunc{Hex2Bin},
+		}, {
+			// printf '\x65\x76\x61\x6c'、echo -e '\x..'
+			Name:       "shell/hex_escape",
+			Regex:      regexp.MustCompile(`(?:printf|echo\s+-e)\s+['"](?:\\x[0-9a-fA-F]{2})+['"]`),
+			DataFilter: regexp.MustCompile(`(?:\\x[0-9a-fA-F]{2})+`),
+			PreDecodeActions: []Action{
+				{Func: StringReplace, Arguments: []interface{}{`\x`, "", -1}},
+			},
+			Functions: []BaseFunc{Hex2Bin},
+		},
+	},
+	Tags: []Tag{
+		{Name: "shell/dev_tcp", Regex: regexp.MustCompile(`/dev/(?:tcp|udp)/[\w.\-$]+/\d+`), Scored: 70},
+		{Name: "shell/nc_exec", Regex: regexp.MustCompile(`\b(?:nc|ncat|netcat)(?:\.\w+)?\s+[^|;\n]*-[ec]\s*(?:/bin/)?(?:ba|z)?sh\b`), Scored: 70},
+		{Name: "shell/mkfifo", Regex: regexp.MustCompile(`(?:mkfifo|mknod)\s+\S+(?:\s+p)?\s*[;&|][^\n]{0,100}?\b(?:nc|ncat|netcat|telnet|openssl)\b`), Scored: 70},
+		{Name: "shell/interactive", Regex: regexp.MustCompile(`\b(?:ba)?sh\s+-i\s*(?:>&|[012]?>&|<&)`), Scored: 50},
+		{Name: "shell/cgi_command", Regex: regexp.MustCompile(`(?:\beval\b|\b(?:ba)?sh\s+-c)[^\n]*\$\{?(?:QUERY_STRING|HTTP_[A-Z_]+)`), Scored: 70},
+		{Name: "shell/eval_decoded", Regex: regexp.MustCompile(`(?:\beval\b[^\n]*\$\(\s*(?:echo|printf)[^\n]*\|\s*(?:base64\s+(?:-d|--decode)|xxd\s+-r|rev)|\|\s*(?:base64\s+(?:-d|--decode)|xxd\s+-r\s+-p)\s*\|\s*(?:/bin/)?(?:ba)?sh\b)`), Scored: 60},
+	},
+	Supports: []string{"sh", "bash", "cgi"},
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// 图片、样式表等静态文件中出现服务端代码时的命中
+const (
+	SNIFFER                = "sniffer"
+	ExtensionMismatchRule  = "sniffer/extension_mismatch"
+	ExtensionMismatchDesc  = "File with a static or binary extension contains server-side code"
+	ExtensionMismatchScore = 25
+)
+
+// 同样会被服务端执行的扩展名变体
+var extAliases = map[string]string{
+	"phtml": "php",
+	"php3":  "php",
+	"php4":  "php",
+	"php5":  "php",
+	"php7":  "php",
+	"pht":   "php",
+	"phar":  "php",
+	"inc":   "php",
+	"jspf":  "jsp",
+	"jsw":   "jsp",
+	"jsv":   "jsp",
+	"cer":   "asp",
+	"asa":   "asp",
+	"cdx":   "asp",
+	"ascx":  "aspx",
+	"cfml":  "cfm",
+	"cfc":   "cfm",
+}
+
+// 内容中的服务端代码特征，出现在文件任意位置均可，按语言累计权重
+type sniffMarker struct {
+	lang   string
+	regex  *regexp.Regexp
+	weight int
+}
+
+var sniffMarkers = []sniffMarker{
+	{lang: "php", regex: regexp.MustCompile(`(?i)<\?php\b`), weight: 3},
+	{lang: "php", regex: regexp.MustCompile(`<\?=`), weight: 2},
+	{lang: "php", regex: regexp.MustCompile(`<\?\s+(?:\$|@?(?:eval|assert|system|echo|include|require)\b)`), weight: 2},
+	{lang: "php", regex: regexp.MustCompile(`\$_(?:GET|POST|REQUEST|COOKIE|SERVER|FILES)\s*\[`), weight: 1},
+	{lang: "asp", regex: regexp.MustCompile(`(?i)<%@\s*Language\s*=\s*"?(?:VBScript|JScript)`), weight: 3},
+	{lang: "asp", regex: regexp.MustCompile(`(?i)<%\s*(?:Response\.Write|Set\s+\w+\s*=\s*Server\.CreateObject|Dim\s|execute(?:global)?\s*[\(\s]*request)`), weight: 2},
+	{lang: "asp", regex: regexp.MustCompile(`(?i)<script\s[^>]*language\s*=\s*"?vbscript[^>]*runat\s*=\s*"?server`), weight: 3},
+	{lang: "aspx", regex: regexp.MustCompile(`(?i)<%@\s*(?:Page|WebHandler|WebService|Control)\s[^%]*Language\s*=`), weight: 3},
+	{lang: "aspx", regex: regexp.MustCompile(`(?i)<%@\s*(?:Import\s+Namespace|Assembly\s+Name)\s*=`), weight: 2},
+	{lang: "jsp", regex: regexp.MustCompile(`<%@\s*page\s[^%]*(?:import|contentType|pageEncoding)\s*=`), weight: 3},
+	{lang: "jsp", regex: regexp.MustCompile(`<jsp:(?:root|scriptlet|declaration|directive)`), weight: 3},
+	{lang: "jsp", regex: regexp.MustCompile(`<%[!=]?\s*[^%]*\b(?:request\.getParameter|Runtime\.getRuntime|out\.print(?:ln)?)\s*\(`), weight: 2},
+	{lang: "cfm", regex: regexp.MustCompile(`(?i)<cf(?:execute|set|output|query|file|script|if|include|http)\b`), weight: 2},
+}
+
+// 至少达到该权重才认为内容是对应的语言
+const minSniffWeight = 2
+
+var shebangRegex = regexp.MustCompile(`^#!\s*/(?:usr/)?(?:local/)?bin/(?:env\s+)?(python|perl|ruby|bash|sh|node)\d*(?:\.\d+)?\b`)
+
+var shebangTypes = map[string]string{
+	"python": "py",
+	"perl":   "pl",
+	"ruby":   "rb",
+	"bash":   "sh",
+	"sh":     "sh",
+	"node":   "js",
+}
+
+type sniffResult struct {
+	lang   string
+	marker string
+	offset int
+}
+
+// 统计内容中各语言特征的权重，返回权重最高的语言及其第一个特征
+func sniffLanguage(content string) sniffResult {
+	weights := map[string]int{}
+	first := map[string]sniffResult{}
+	for _, m := range sniffMarkers {
+		loc := m.regex.FindStringIndex(content)
+		if loc == nil {
+			continue
+		}
+		weights[m.lang] += m.weight
+		if f, ok := first[m.lang]; !ok || loc[0] < f.offset {
+			first[m.lang] = sniffResult{lang: m.lang, marker: content[loc[0]:loc[1]], offset: loc[0]}
+		}
+	}
+	var best sniffResult
+	bestWeight := 0
+	for _, m := range sniffMarkers {
+		if w := weights[m.lang]; w >= minSniffWeight && w > bestWeight {
+			best, bestWeight = first[m.lang], w
+		}
+	}
+	return best
+}
+
+func fileExtension(filename string) string {
+	// 压缩包中的文件形如 a.war!/x.jsp
+	if i := strings.LastIndex(filename, "!/"); i >= 0 {
+		filename = filename[i+2:]
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(strings.ReplaceAll(filename, "\\", "/")), "."))
+}
+
+// 根据扩展名、扩展名变体、shebang及内容判断文件可能的类型，插件的Supports与其中任意一个相同即适用。
+// 静态文件的内容为服务端代码时返回对应的命中
+func detectFileTypes(filename, content string) ([]string, *Hit) {
+	var types []string
+	add := func(t string) {
+		if t != "" && !hasElement(types, t) {
+			types = append(types, t)
+		}
+	}
+	ext := fileExtension(filename)
+	add(ext)
+	add(extAliases[ext])
+	if m := shebangRegex.FindStringSubmatch(content); m != nil {
+		add(shebangTypes[m[1]])
+	}
+
+	sniffed := sniffLanguage(content)
+	if sniffed.lang == "" {
+		return types, nil
+	}
+	add(sniffed.lang)
+	// 模板、文档等文本文件中常有代码，只有静态文件中出现服务端代码才算不符
+	if !staticExtensions[ext] {
+		return types, nil
+	}
+	hit := &Hit{
+		Plugin:  SNIFFER,
+		Tag:     ExtensionMismatchRule,
+		Snippet: sniffed.marker,
+		Offset:  sniffed.offset,
+		Line:    lineOf(content, sniffed.offset),
+	}
+	if len(hit.Snippet) > maxSnippetLength {
+		hit.Snippet = hit.Snippet[:maxSnippetLength]
+	}
+	return types, hit
+}
+
+// 正常情况下不应包含服务端代码的静态文件及二进制文件扩展名
+var staticExtensions = map[string]bool{
+	"png":   true,
+	"jpg":   true,
+	"jpeg":  true,
+	"gif":   true,
+	"bmp":   true,
+	"ico":   true,
+	"webp":  true,
+	"svg":   true,
+	"tif":   true,
+	"tiff":  true,
+	"css":   true,
+	"woff":  true,
+	"woff2": true,
+	"ttf":   true,
+	"otf":   true,
+	"eot":   true,
+	"pdf":   true,
+	"mp3":   true,
+	"mp4":   true,
+	"wav":   true,
+	"avi":   true,
+	"swf":   true,
+}
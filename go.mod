@@ -6,3 +6,7 @@ require (
 	github.com/golang/glog v1.1.1
 	github.com/patrikeh/go-deep v0.0.0-20230427173908-a2775168ab3d
 )
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
@@ -0,0 +1,321 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 压缩包的默认限制
+const (
+	MaxArchiveSize    = 100 * 1024 * 1024 // 压缩包本身（包括嵌套的压缩包）的大小
+	MaxArchiveDepth   = 3                 // 嵌套层数
+	MaxArchiveEntries = 10000             // 一个压缩包（包括嵌套的压缩包）中最多检测的文件数
+	MaxArchiveBytes   = 512 * 1024 * 1024 // 解压后的总字节数
+	MaxArchiveRatio   = 100               // 解压后与压缩后大小的最大比例
+
+	// 解压后不超过该大小时不检查压缩比例，避免误判高度重复的小文件
+	minRatioCheckSize = 1024 * 1024
+)
+
+const (
+	formatZip = "zip"
+	formatTar = "tar"
+	formatTgz = "tgz"
+	formatGz  = "gz"
+)
+
+type ArchiveLimits struct {
+	MaxSize    int64
+	MaxDepth   int
+	MaxEntries int
+	MaxBytes   int64
+	MaxRatio   int64
+}
+
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxSize:    MaxArchiveSize,
+	MaxDepth:   MaxArchiveDepth,
+	MaxEntries: MaxArchiveEntries,
+	MaxBytes:   MaxArchiveBytes,
+	MaxRatio:   MaxArchiveRatio,
+}
+
+// 超出限制时停止展开整个压缩包
+var errArchiveLimit = errors.New("archive limit exceeded")
+
+var zipExts = map[string]bool{
+	".zip": true,
+	".jar": true,
+	".war": true,
+	".ear": true,
+}
+
+// 是否展开压缩包，关闭时压缩包作为普通文件检测
+func WithArchives(enabled bool) Option {
+	return func(s *Scanner) {
+		s.archives = enabled
+	}
+}
+
+func WithArchiveLimits(limits ArchiveLimits) Option {
+	return func(s *Scanner) {
+		s.archiveLimits = limits
+	}
+}
+
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return formatTgz
+	case strings.HasSuffix(lower, ".tar"):
+		return formatTar
+	case strings.HasSuffix(lower, ".gz"):
+		return formatGz
+	case zipExts[filepath.Ext(lower)]:
+		return formatZip
+	}
+	return ""
+}
+
+func IsArchive(name string) bool {
+	return archiveFormat(name) != ""
+}
+
+func (s *Scanner) isArchive(name string) bool {
+	return s.archives && IsArchive(name)
+}
+
+type archiveState struct {
+	ctx     context.Context
+	entries int
+	bytes   int64
+}
+
+// 限制解压后的数据量不超过压缩数据的MaxRatio倍
+type ratioReader struct {
+	r         io.Reader
+	remaining int64
+	ratio     int64
+}
+
+func (s *Scanner) newRatioReader(r io.Reader, compressed int64) io.Reader {
+	max := compressed * s.archiveLimits.MaxRatio
+	if max < minRatioCheckSize {
+		max = minRatioCheckSize
+	}
+	return &ratioReader{r: r, remaining: max, ratio: s.archiveLimits.MaxRatio}
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// 恰好读完时不算超出
+		var b [1]byte
+		if n, err := r.r.Read(b[:]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("%w: compression ratio exceeds %d", errArchiveLimit, r.ratio)
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// 检测zip（包括jar/war/ear）、tar、tar.gz/tgz及gz压缩包，其中的文件以 a.war!/WEB-INF/shell.jsp 形式的路径逐个交给fn，
+// 嵌套的压缩包会递归展开。内容不是对应格式时返回错误
+func (s *Scanner) ScanArchive(content []byte, name string, fn func(*Result)) error {
+	return s.scanArchiveContext(context.Background(), content, name, fn)
+}
+
+// ctx结束时停止展开，返回ctx.Err()
+func (s *Scanner) scanArchiveContext(ctx context.Context, content []byte, name string, fn func(*Result)) error {
+	err := s.scanArchive(content, name, 1, &archiveState{ctx: ctx}, fn)
+	if errors.Is(err, errArchiveLimit) {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return err
+}
+
+func (s *Scanner) scanArchive(content []byte, name string, depth int, st *archiveState, fn func(*Result)) error {
+	switch archiveFormat(name) {
+	case formatZip:
+		return s.scanZip(content, name, depth, st, fn)
+	case formatTar:
+		return s.scanTar(bytes.NewReader(content), name, depth, st, fn)
+	case formatTgz:
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("open archive %s error: %v", name, err)
+		}
+		return s.scanTar(s.newRatioReader(gr, int64(len(content))), name, depth, st, fn)
+	case formatGz:
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("open archive %s error: %v", name, err)
+		}
+		member := gr.Name
+		if member == "" {
+			member = strings.TrimSuffix(path.Base(filepath.ToSlash(name)), path.Ext(name))
+		}
+		return s.scanMember(name, member, s.newRatioReader(gr, int64(len(content))), -1, depth, st, fn)
+	}
+	return fmt.Errorf("unsupported archive %s", name)
+}
+
+func (s *Scanner) scanZip(content []byte, name string, depth int, st *archiveState, fn func(*Result)) error {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return fmt.Errorf("open archive %s error: %v", name, err)
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			fn(&Result{Path: name + "!/" + f.Name, Err: err})
+			continue
+		}
+		err = s.scanMember(name, f.Name, s.newRatioReader(rc, int64(f.CompressedSize64)), int64(f.UncompressedSize64), depth, st, fn)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tar中的文件按顺序流式读取
+func (s *Scanner) scanTar(r io.Reader, name string, depth int, st *archiveState, fn func(*Result)) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, errArchiveLimit) {
+				return err
+			}
+			return fmt.Errorf("read archive %s error: %v", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := s.scanMember(name, hdr.Name, tr, hdr.Size, depth, st, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// 检测压缩包中的一个文件，size为文件头中声明的大小，未知时为-1。只有超出压缩包限制时返回错误
+func (s *Scanner) scanMember(archive, member string, r io.Reader, size int64, depth int, st *archiveState, fn func(*Result)) error {
+	if err := st.ctx.Err(); err != nil {
+		return err
+	}
+	p := archive + "!/" + member
+	limits := s.archiveLimits
+	nested := IsArchive(member)
+	// 超过嵌套层数的压缩包不展开，作为错误报告，继续检测其他文件
+	if nested && depth >= limits.MaxDepth {
+		fn(&Result{Path: p, Err: fmt.Errorf("%w: nested deeper than %d levels", errArchiveLimit, limits.MaxDepth)})
+		return nil
+	}
+	limit := s.maxFileSize
+	if nested {
+		limit = limits.MaxSize
+	}
+	// 与遍历目录时一致，跳过过大的文件
+	if size >= limit {
+		return nil
+	}
+	if st.entries >= limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", errArchiveLimit, limits.MaxEntries)
+	}
+	st.entries++
+
+	// 实际大小可能与文件头中声明的不同，读取时同样需要限制
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		if errors.Is(err, errArchiveLimit) {
+			return err
+		}
+		fn(&Result{Path: p, Err: err})
+		return nil
+	}
+	if int64(len(data)) > limit {
+		fn(&Result{Path: p, Err: fmt.Errorf("uncompressed size exceeds %d bytes", limit)})
+		return nil
+	}
+	st.bytes += int64(len(data))
+	if st.bytes > limits.MaxBytes {
+		return fmt.Errorf("%w: more than %d uncompressed bytes", errArchiveLimit, limits.MaxBytes)
+	}
+
+	if nested {
+		entries := st.entries
+		err := s.scanArchive(data, p, depth+1, st, fn)
+		if err == nil || errors.Is(err, errArchiveLimit) || st.ctx.Err() != nil {
+			return err
+		}
+		// 扩展名是压缩包但格式不符时作为普通文件检测，已经读出部分文件时只报告错误
+		if st.entries != entries || int64(len(data)) > s.maxFileSize {
+			fn(&Result{Path: p, Err: err})
+			return nil
+		}
+	}
+	fn(s.scan(data, p))
+	return nil
+}
+
+func (s *Scanner) scanArchiveFile(path string) []*Result {
+	f, err := os.Open(path)
+	if err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	content, err := ioutil.ReadAll(io.LimitReader(f, s.archiveLimits.MaxSize+1))
+	if err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+	if int64(len(content)) > s.archiveLimits.MaxSize {
+		return []*Result{{Path: path, Err: fmt.Errorf("content of %s exceeds %d bytes", path, s.archiveLimits.MaxSize)}}
+	}
+	return s.scanArchiveContent(context.Background(), content, path)
+}
+
+func (s *Scanner) scanArchiveContent(ctx context.Context, content []byte, path string) []*Result {
+	var results []*Result
+	err := s.scanArchiveContext(ctx, content, path, func(r *Result) {
+		results = append(results, r)
+	})
+	switch {
+	case errors.Is(err, errArchiveLimit), ctx.Err() != nil:
+		results = append(results, &Result{Path: path, Err: err})
+	case err != nil && len(results) > 0:
+		results = append(results, &Result{Path: path, Err: err})
+	case err != nil:
+		// 格式不符时作为普通文件检测
+		if int64(len(content)) > s.maxFileSize {
+			return []*Result{{Path: path, Err: err}}
+		}
+		results = []*Result{s.scan(content, path)}
+	}
+	return results
+}
@@ -0,0 +1,295 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const BaselineVersion = 2
+
+// 与快照相比的变化类型
+const (
+	ChangeAdded      = "added"
+	ChangeModified   = "modified"
+	ChangeDeleted    = "deleted"
+	ChangeUnreadable = "unreadable" // 文件无法读取，不能确定是否变化
+)
+
+// 可信部署的文件快照。路径相对于快照的根目录并以/分隔，文件按路径排序，
+// 快照可以在其他主机上对根目录不同的部署使用，也可以单独签名后保存
+type Baseline struct {
+	Version     int             `json:"version"`
+	Created     string          `json:"created"`
+	Fingerprint string          `json:"fingerprint"` // 生成快照时的插件、计算器、模型摘要
+	Files       []*BaselineFile `json:"files"`
+}
+
+type BaselineFile struct {
+	Path   string  `json:"path"`
+	SHA256 string  `json:"sha256"`
+	Size   int64   `json:"size"`
+	Mode   string  `json:"mode"`
+	Link   string  `json:"link,omitempty"` // 符号链接的目标，符号链接不计算摘要也不检测
+	Score  float64 `json:"score"`          // 压缩包为其中文件的最高得分，超过大小限制的文件不检测，得分为0
+}
+
+type Change struct {
+	Type    string        `json:"type"`
+	Path    string        `json:"path"`
+	Score   float64       `json:"score"`
+	Old     *BaselineFile `json:"old,omitempty"`
+	New     *BaselineFile `json:"new,omitempty"`
+	Results []*Result     `json:"results,omitempty"` // 新增或内容修改的文件的检测结果
+	Err     error         `json:"-"`
+}
+
+type fileState struct {
+	file    *BaselineFile
+	results []*Result
+	err     error
+}
+
+func LoadBaseline(path string) (*Baseline, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read baseline %s error: %v", path, err)
+	}
+	var b Baseline
+	if err := json.Unmarshal(content, &b); err != nil {
+		return nil, fmt.Errorf("unmarshal baseline %s error: %v", path, err)
+	}
+	if b.Version != BaselineVersion {
+		return nil, fmt.Errorf("baseline %s has unsupported version %d, create it again with -snapshot", path, b.Version)
+	}
+	return &b, nil
+}
+
+// 输出格式固定，相同的快照得到相同的字节，便于签名校验
+func (b *Baseline) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// 计算目录下所有常规文件的摘要并检测，记录符号链接的目标，任一文件读取失败时返回错误
+func (s *Scanner) Snapshot(root string) (*Baseline, error) {
+	states, err := s.walkFiles(root, func(*BaselineFile) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{
+		Version:     BaselineVersion,
+		Created:     time.Now().UTC().Format(time.RFC3339),
+		Fingerprint: s.Fingerprint(),
+		Files:       []*BaselineFile{},
+	}
+	for _, rel := range sortedKeys(states) {
+		st := states[rel]
+		if st.err != nil {
+			return nil, fmt.Errorf("snapshot %s error: %v", filepath.Join(root, filepath.FromSlash(rel)), st.err)
+		}
+		b.Files = append(b.Files, st.file)
+	}
+	return b, nil
+}
+
+// 与快照比较，返回新增、修改、删除及无法读取的文件及符号链接，只有新增及内容变化的文件会被检测。
+// 只有权限变化的文件沿用快照中的得分，快照的Fingerprint与当前不同时重新检测
+func (s *Scanner) Diff(root string, base *Baseline) ([]*Change, error) {
+	index := make(map[string]*BaselineFile)
+	for _, f := range base.Files {
+		index[f.Path] = f
+	}
+	rescan := base.Fingerprint != s.Fingerprint()
+	states, err := s.walkFiles(root, func(f *BaselineFile) bool {
+		old, ok := index[f.Path]
+		return !ok || old.SHA256 != f.SHA256 || old.Size != f.Size || (rescan && old.Mode != f.Mode)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*Change
+	for _, rel := range sortedKeys(states) {
+		st := states[rel]
+		old, ok := index[rel]
+		switch {
+		case st.err != nil:
+			changes = append(changes, &Change{Type: ChangeUnreadable, Path: rel, Old: old, Err: st.err})
+		case !ok:
+			changes = append(changes, &Change{Type: ChangeAdded, Path: rel, Score: st.file.Score, New: st.file, Results: st.results})
+		case old.SHA256 != st.file.SHA256 || old.Size != st.file.Size || old.Link != st.file.Link:
+			changes = append(changes, &Change{Type: ChangeModified, Path: rel, Score: st.file.Score, Old: old, New: st.file, Results: st.results})
+		case old.Mode != st.file.Mode:
+			if !rescan {
+				st.file.Score = old.Score
+			}
+			changes = append(changes, &Change{Type: ChangeModified, Path: rel, Score: st.file.Score, Old: old, New: st.file, Results: st.results})
+		}
+	}
+	for _, f := range base.Files {
+		if _, ok := states[f.Path]; !ok {
+			changes = append(changes, &Change{Type: ChangeDeleted, Path: f.Path, Score: f.Score, Old: f})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// 并发计算root下每个常规文件的摘要，scan返回true时同时检测文件内容。符号链接只记录目标，不跟随
+func (s *Scanner) walkFiles(root string, scan func(*BaselineFile) bool) (map[string]*fileState, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid snapshot object: %s is not a directory", root)
+	}
+
+	type job struct {
+		path string
+		rel  string
+		info os.FileInfo
+		err  error
+	}
+	jobs := make(chan job)
+	states := make(map[string]*fileState)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				st := &fileState{err: j.err}
+				switch {
+				case st.err != nil:
+				case j.info.Mode()&fs.ModeSymlink != 0:
+					st.file, st.err = linkFile(j.path, j.rel, j.info)
+				default:
+					st.file, st.results, st.err = s.hashFile(j.path, j.rel, j.info, scan)
+				}
+				mu.Lock()
+				states[j.rel] = st
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		rel, relErr := filepath.Rel(root, path)
+		if relErr != nil {
+			return relErr
+		}
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			// 根目录本身无法读取时直接返回
+			if path == root {
+				return err
+			}
+			jobs <- job{path: path, rel: rel, err: err}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			jobs <- job{path: path, rel: rel, err: err}
+			return nil
+		}
+		jobs <- job{path: path, rel: rel, info: info}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (s *Scanner) hashFile(path, rel string, info os.FileInfo, scan func(*BaselineFile) bool) (*BaselineFile, []*Result, error) {
+	f := &BaselineFile{Path: rel, Size: info.Size(), Mode: info.Mode().String()}
+	// 超过大小限制的文件只计算摘要
+	if info.Size() >= s.sizeLimit(path) {
+		hash, size, err := hashReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.SHA256, f.Size = hash, size
+		return f, nil, nil
+	}
+
+	content, err := s.readFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(content)
+	f.SHA256 = hex.EncodeToString(sum[:])
+	f.Size = int64(len(content))
+	if !scan(f) {
+		return f, nil, nil
+	}
+	// 压缩包超出限制等错误通过结果返回，不影响文件本身的摘要
+	results := s.ScanContent(content, path)
+	for _, r := range results {
+		if r.Err == nil && r.Score > f.Score {
+			f.Score = r.Score
+		}
+	}
+	f.Score = math.Round(f.Score*100) / 100
+	return f, results, nil
+}
+
+func linkFile(path, rel string, info os.FileInfo) (*BaselineFile, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BaselineFile{Path: rel, Size: int64(len(target)), Mode: info.Mode().String(), Link: filepath.ToSlash(target)}, nil
+}
+
+func hashReader(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func sortedKeys(states map[string]*fileState) []string {
+	keys := make([]string, 0, len(states))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaselineDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, name string) {
+		t.Helper()
+		_ = os.Remove(filepath.Join(dir, name))
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.php", "<?php echo 'hello';\n")
+	write("shell.php", `<?php @eval($_POST["x"]); ?>`+"\n")
+	link("index.php", "home.php")
+
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := s.Snapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var home *BaselineFile
+	for _, f := range base.Files {
+		if f.Path == "home.php" {
+			home = f
+		}
+	}
+	if home == nil || home.Link != "index.php" {
+		t.Fatalf("symlink home.php not recorded: %+v", base.Files)
+	}
+
+	diff := func(base *Baseline) map[string]*Change {
+		t.Helper()
+		changes, err := s.Diff(dir, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]*Change{}
+		for _, c := range changes {
+			m[c.Path] = c
+		}
+		return m
+	}
+	if changes := diff(base); len(changes) != 0 {
+		t.Fatalf("unchanged directory has changes: %v", changes)
+	}
+
+	// 符号链接指向其他文件、新增的符号链接
+	link("/etc/passwd", "home.php")
+	link("/var/www/other/shell.php", "upload.php")
+	changes := diff(base)
+	if c := changes["home.php"]; c == nil || c.Type != ChangeModified || c.New.Link != "/etc/passwd" {
+		t.Errorf("retargeted symlink home.php: %+v", c)
+	}
+	if c := changes["upload.php"]; c == nil || c.Type != ChangeAdded || c.New.Link != "/var/www/other/shell.php" {
+		t.Errorf("added symlink upload.php: %+v", c)
+	}
+
+	// 只有权限变化时沿用快照中的得分，快照的Fingerprint不同时重新检测
+	if err := os.Chmod(filepath.Join(dir, "shell.php"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range base.Files {
+		if f.Path == "shell.php" {
+			f.Score = 1
+		}
+	}
+	if c := diff(base)["shell.php"]; c == nil || c.Score != 1 || c.Results != nil {
+		t.Errorf("shell.php with the same fingerprint should keep the score of the baseline: %+v", c)
+	}
+	base.Fingerprint = "other"
+	if c := diff(base)["shell.php"]; c == nil || c.Score <= 1 || c.Results == nil {
+		t.Errorf("shell.php with a different fingerprint should be scanned again: %+v", c)
+	}
+}
@@ -0,0 +1,357 @@
+package scanner
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// 缓存格式变化时递增，使已有的缓存失效。程序文件的摘要也计入缓存版本，修改检测逻辑并重新编译后缓存自动失效；
+// 无法读取程序文件时只能依赖构建信息中的vcs版本，不确定时修改检测逻辑也递增该值
+const CacheVersion = 3
+
+var (
+	executableOnce sync.Once
+	executableHash string
+)
+
+// 检测结果缓存，文件的大小、修改时间及inode变更时间都未变化时直接复用结果，
+// 否则读取内容按sha256及扩展名查找，内容相同（如复制、重命名）且扩展名相同的文件也不会重复检测。
+// 单独的修改时间不可信（如touch -r），inode变更时间无法由用户设置。
+// 插件、计算器、模型或大小限制变化时整个缓存失效
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	version string
+	entries map[string]*cacheEntry // 路径到缓存项
+	hashes  map[string]*cacheEntry // 内容sha256及文件类型到缓存项
+	seen    map[string]bool        // 本次检测过的路径
+	hits    int
+	misses  int
+}
+
+type cacheEntry struct {
+	Path       string          `json:"path"`
+	Size       int64           `json:"size"`
+	ModTime    int64           `json:"mtime"`
+	ChangeTime int64           `json:"ctime"`
+	Hash       string          `json:"sha256"`
+	Kind       string          `json:"kind"`
+	Results    []*cachedResult `json:"results"`
+}
+
+// 模型输入及匹配次数不在报告中输出，但训练及SARIF输出会用到
+type cachedResult struct {
+	Result
+	Features []float64        `json:"features"`
+	Matches  map[string]int32 `json:"matches,omitempty"`
+}
+
+type cacheFile struct {
+	Version string        `json:"version"`
+	Entries []*cacheEntry `json:"entries"`
+}
+
+// 打开缓存文件，文件不存在时返回空的缓存，Save时创建
+func OpenCache(path string) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		entries: make(map[string]*cacheEntry),
+		hashes:  make(map[string]*cacheEntry),
+		seen:    make(map[string]bool),
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open cache %s error: %v", path, err)
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read cache %s error: %v", path, err)
+	}
+	var cf cacheFile
+	if err := json.NewDecoder(zr).Decode(&cf); err != nil {
+		return nil, fmt.Errorf("read cache %s error: %v", path, err)
+	}
+	c.version = cf.Version
+	for _, e := range cf.Entries {
+		c.entries[e.Path] = e
+		c.hashes[e.key()] = e
+	}
+	return c, nil
+}
+
+func WithCache(c *Cache) Option {
+	return func(s *Scanner) {
+		s.cache = c
+	}
+}
+
+// 版本不同时清空缓存
+func (c *Cache) setVersion(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == version {
+		return
+	}
+	c.version = version
+	c.entries = make(map[string]*cacheEntry)
+	c.hashes = make(map[string]*cacheEntry)
+}
+
+// 复用结果及重新检测的文件数
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// 检测结果与文件名相关的部分：插件及扩展名不符按扩展名判断，压缩包按后缀判断格式，
+// gz中文件的扩展名取自去掉.gz后的文件名
+func cacheKind(path string) string {
+	ext := filepath.Ext(path)
+	format := archiveFormat(path)
+	kind := format + ":" + strings.ToLower(ext)
+	if format == formatGz {
+		kind += strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ext)))
+	}
+	return kind
+}
+
+func (e *cacheEntry) key() string {
+	return e.Hash + " " + e.Kind
+}
+
+func (e *cacheEntry) unchanged(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() && e.ChangeTime == changeTime(info)
+}
+
+// 文件未变化时不读取内容，直接复用上次的结果
+func (c *Cache) lookupStat(path string, info os.FileInfo) ([]*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[path]
+	if !ok || !e.unchanged(info) {
+		return nil, false
+	}
+	c.seen[path] = true
+	c.hits++
+	return e.results(path), true
+}
+
+// 按内容及文件类型查找，命中时同时记录当前路径
+func (c *Cache) lookup(path string, info os.FileInfo, hash string) ([]*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.hashes[hash+" "+cacheKind(path)]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	results := e.results(path)
+	c.put(path, info, hash, results)
+	c.hits++
+	return results, true
+}
+
+func (c *Cache) store(path string, info os.FileInfo, hash string, results []*Result) {
+	// 读取失败的结果不缓存，下次重新检测
+	for _, r := range results {
+		if r.Err != nil {
+			return
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(path, info, hash, results)
+}
+
+func (c *Cache) put(path string, info os.FileInfo, hash string, results []*Result) {
+	e := &cacheEntry{
+		Path:       path,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		ChangeTime: changeTime(info),
+		Hash:       hash,
+		Kind:       cacheKind(path),
+	}
+	for _, r := range results {
+		e.Results = append(e.Results, &cachedResult{Result: *r, Features: r.Features, Matches: r.Matches})
+	}
+	c.entries[path] = e
+	c.hashes[e.key()] = e
+	c.seen[path] = true
+}
+
+// 复制缓存的结果，路径替换为当前文件，压缩包中文件的路径前缀同样替换
+func (e *cacheEntry) results(path string) []*Result {
+	var results []*Result
+	for _, cr := range e.Results {
+		r := cr.Result
+		r.Features = cr.Features
+		r.Matches = cr.Matches
+		if r.Path == e.Path {
+			r.Path = path
+		} else if strings.HasPrefix(r.Path, e.Path+"!/") {
+			r.Path = path + r.Path[len(e.Path):]
+		}
+		results = append(results, &r)
+	}
+	return results
+}
+
+// 写入缓存文件，本次未检测且已不存在的文件被移除
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	cf := cacheFile{Version: c.version}
+	for path, e := range c.entries {
+		if !c.seen[path] {
+			if _, err := os.Lstat(path); err != nil {
+				continue
+			}
+		}
+		cf.Entries = append(cf.Entries, e)
+	}
+	c.mu.Unlock()
+
+	// 先写入临时文件再重命名，中断时不会留下不完整的缓存
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("write cache %s error: %v", c.path, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	zw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(zw).Encode(cf)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		return fmt.Errorf("write cache %s error: %v", c.path, err)
+	}
+	return nil
+}
+
+// 插件、计算器、模型及检测参数的摘要，作为缓存的版本
+func (s *Scanner) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "cache:%d\n", CacheVersion)
+	// 程序本身更新时检测逻辑可能变化，go build main.go编译的程序没有vcs信息，同时使用程序文件的摘要
+	fmt.Fprintf(h, "executable:%s\n", executableDigest())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(h, "build:%s\n", info.Main.Version)
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.time" {
+				fmt.Fprintf(h, "%s:%s\n", setting.Key, setting.Value)
+			}
+		}
+	}
+	fmt.Fprintf(h, "limits:%d %t %+v %t\n", s.maxFileSize, s.archives, s.archiveLimits, s.featuresOnly)
+
+	for _, p := range s.plugins {
+		fmt.Fprintf(h, "plugin:%s %v\n", p.Name, p.Supports)
+		for _, d := range p.Decoders {
+			fmt.Fprintf(h, "decoder:%s %v %v\n", d.Name, d.Regex, d.DataFilter)
+			for _, a := range d.PreDecodeActions {
+				fmt.Fprintf(h, "pre:%s %v\n", funcName(a.Func), a.Arguments)
+			}
+			for _, a := range d.PostDecodeActions {
+				fmt.Fprintf(h, "post:%s %v\n", funcName(a.Func), a.Arguments)
+			}
+			for _, f := range d.Functions {
+				fmt.Fprintf(h, "func:%s\n", funcName(f))
+			}
+		}
+		for _, t := range p.Tags {
+			fmt.Fprintf(h, "tag:%s %v %v %t\n", t.Name, t.Regex, t.Scored, t.Repeat)
+		}
+		for _, m := range p.Matchers {
+			fmt.Fprintf(h, "matcher:%T %v\n", m, m.Rules())
+			if fp, ok := m.(interface{ Fingerprint() string }); ok {
+				fmt.Fprintf(h, "fingerprint:%s\n", fp.Fingerprint())
+			}
+		}
+	}
+	for _, c := range s.calculators {
+		fmt.Fprintf(h, "calculator:%s %v %d %v %s %s\n", c.Name, c.Weight, c.CalculateMethod, c.Coefficient, funcName(c.Func), funcName(c.ResultFunc))
+	}
+	if s.model != nil {
+		model, _ := json.Marshal(s.model)
+		h.Write(model)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 当前程序文件的sha256，只计算一次，无法读取时为空
+func executableDigest() string {
+	executableOnce.Do(func() {
+		path, err := os.Executable()
+		if err != nil {
+			return
+		}
+		if hash, _, err := hashReader(path); err == nil {
+			executableHash = hash
+		}
+	})
+	return executableHash
+}
+
+func funcName(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// 文件未变化时直接复用结果，否则读取内容按sha256查找，未命中时检测并缓存。
+// 先取文件信息再读取内容，读取期间文件被修改时下次会重新读取
+func (s *Scanner) scanCachedFile(path string) []*Result {
+	info, err := os.Stat(path)
+	if err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+	if results, ok := s.cache.lookupStat(path, info); ok {
+		return results
+	}
+	content, err := s.readFile(path)
+	if err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if results, ok := s.cache.lookup(path, info, hash); ok {
+		return results
+	}
+	results := s.ScanContent(content, path)
+	s.cache.store(path, info, hash, results)
+	return results
+}
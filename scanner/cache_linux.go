@@ -0,0 +1,16 @@
+//go:build linux
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode的变更时间，touch -r等修改mtime的操作会更新该时间
+func changeTime(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ctim.Nano()
+	}
+	return 0
+}
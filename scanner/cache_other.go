@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+import "os"
+
+func changeTime(info os.FileInfo) int64 {
+	return 0
+}
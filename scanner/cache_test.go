@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	const shell = `<?php @eval($_POST["x"]); ?>` + "\n"
+	img := filepath.Join(dir, "a.png")
+	if err := ioutil.WriteFile(img, []byte(shell), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCache(filepath.Join(dir, "cache.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(WithCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(path string) *Result {
+		t.Helper()
+		results := s.scanFile(path)
+		if len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("scan %s: %+v", path, results)
+		}
+		return results[0]
+	}
+	tags := func(r *Result) map[string]bool {
+		m := map[string]bool{}
+		for _, h := range r.Hits {
+			m[h.Tag] = true
+		}
+		return m
+	}
+
+	if !tags(scan(img))["sniffer/extension_mismatch"] {
+		t.Fatalf("%s should hit sniffer/extension_mismatch", img)
+	}
+	// 未变化的文件不读取内容
+	info, err := os.Stat(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.lookupStat(img, info); !ok {
+		t.Errorf("unchanged %s should be found by size and modification time", img)
+	}
+
+	// 内容相同但扩展名不同的文件不能复用结果
+	php := filepath.Join(dir, "b.php")
+	if err := ioutil.WriteFile(php, []byte(shell), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if tags(scan(php))["sniffer/extension_mismatch"] {
+		t.Errorf("%s reused the result of %s", php, img)
+	}
+	// 内容相同且扩展名相同的文件复用结果
+	copied := filepath.Join(dir, "c.php")
+	if err := ioutil.WriteFile(copied, []byte(shell), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hits, _ := c.Stats()
+	scan(copied)
+	if h, _ := c.Stats(); h != hits+1 {
+		t.Errorf("%s should reuse the result of %s", copied, php)
+	}
+
+	// 修改内容后恢复大小及修改时间（如touch -r）仍需重新检测
+	before := scan(php)
+	padded := "<?php echo 'hello world';           ?>\n"
+	padded = padded[:len(shell)]
+	if err := ioutil.WriteFile(php, []byte(padded), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(0, c.entries[php].ModTime)
+	if err := os.Chtimes(php, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if after := scan(php); after.Score >= before.Score || len(after.Hits) >= len(before.Hits) {
+		t.Errorf("modified %s reused the cached result: %+v", php, after)
+	}
+}
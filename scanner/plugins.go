@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"wxel/core"
+	"wxel/yara"
+)
+
+// 内置插件加上逗号分隔的规则文件及YARA规则文件中的插件，rulesOnly时不使用内置插件
+func LoadPlugins(rules string, rulesOnly bool, yaraRules string) ([]*core.Plugin, error) {
+	plugins := core.GetPlugins()
+	if rules != "" {
+		var extra []*core.Plugin
+		for _, path := range strings.Split(rules, ",") {
+			loaded, err := core.LoadRules(strings.TrimSpace(path))
+			if err != nil {
+				return nil, fmt.Errorf("load rules error: %v", err)
+			}
+			extra = append(extra, loaded...)
+		}
+		if rulesOnly {
+			plugins = nil
+		}
+		plugins = core.MergePlugins(plugins, extra)
+	} else if rulesOnly {
+		return nil, fmt.Errorf("-rules-only requires rule files specified by -r")
+	}
+
+	if yaraRules != "" {
+		var yrs []*yara.Rule
+		for _, path := range strings.Split(yaraRules, ",") {
+			loaded, err := yara.LoadRules(strings.TrimSpace(path))
+			if err != nil {
+				return nil, fmt.Errorf("load yara rules error: %v", err)
+			}
+			yrs = append(yrs, loaded...)
+		}
+		plugins = append(plugins, yara.NewPlugin(yrs))
+	}
+	return plugins, nil
+}
@@ -0,0 +1,240 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"wxel/core"
+)
+
+const (
+	SarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	SarifVersion = "2.1.0"
+	ToolName     = "WXEL"
+	ToolURI      = "https://github.com/LinanV/ai-webshell-scanner"
+
+	// 没有命中任何规则、仅因模型得分达到阈值而告警的文件使用的规则
+	SarifModelRule = "model/score"
+	SarifModelDesc = "model prediction score reached the alert threshold without any matched rule"
+	// 未设置告警阈值时区分error与warning的得分
+	SarifDefaultThreshold = 50
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string                 `json:"ruleId"`
+	RuleIndex        int                    `json:"ruleIndex"`
+	Level            string                 `json:"level"`
+	Message          sarifMessage           `json:"message"`
+	Locations        []sarifLocation        `json:"locations"`
+	RelatedLocations []sarifLocation        `json:"relatedLocations,omitempty"`
+	Properties       map[string]interface{} `json:"properties"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int           `json:"startLine"`
+	Snippet   *sarifMessage `json:"snippet,omitempty"`
+}
+
+// 每个Tag、Decoder及Matcher规则对应一条规则，每个命中规则或得分不低于threshold的文件对应一条结果，
+// 结果以得分最高的Tag作为规则，其余命中作为相关位置，没有命中时使用SarifModelRule。
+// 得分不低于threshold的结果为error，否则为warning，threshold为0时使用SarifDefaultThreshold
+func (s *Scanner) WriteSARIF(w io.Writer, results []*Result, threshold float64) error {
+	if threshold <= 0 {
+		threshold = SarifDefaultThreshold
+	}
+	var rules []sarifRule
+	ruleIndex := make(map[string]int)
+	tagScored := make(map[string]float64)
+	addRule := func(rule sarifRule) {
+		if _, ok := ruleIndex[rule.ID]; ok {
+			return
+		}
+		ruleIndex[rule.ID] = len(rules)
+		rules = append(rules, rule)
+	}
+	for _, plugin := range s.plugins {
+		for _, t := range plugin.Tags {
+			tagScored[t.Name] = t.Scored
+			addRule(sarifRule{
+				ID:               t.Name,
+				ShortDescription: sarifMessage{Text: plugin.Desc},
+				Properties:       map[string]interface{}{"plugin": plugin.Name, "kind": "tag", "scored": t.Scored},
+			})
+		}
+		for _, d := range plugin.Decoders {
+			addRule(sarifRule{
+				ID:               d.Name,
+				ShortDescription: sarifMessage{Text: plugin.Desc},
+				Properties:       map[string]interface{}{"plugin": plugin.Name, "kind": "decoder"},
+			})
+		}
+		for _, m := range plugin.Matchers {
+			for _, name := range m.Rules() {
+				addRule(sarifRule{
+					ID:               name,
+					ShortDescription: sarifMessage{Text: plugin.Desc},
+					Properties:       map[string]interface{}{"plugin": plugin.Name, "kind": "matcher"},
+				})
+			}
+		}
+	}
+	tagScored[core.ExtensionMismatchRule] = core.ExtensionMismatchScore
+	addRule(sarifRule{
+		ID:               core.ExtensionMismatchRule,
+		ShortDescription: sarifMessage{Text: core.ExtensionMismatchDesc},
+		Properties:       map[string]interface{}{"plugin": core.SNIFFER, "kind": "sniffer", "scored": core.ExtensionMismatchScore},
+	})
+	addRule(sarifRule{
+		ID:               SarifModelRule,
+		ShortDescription: sarifMessage{Text: SarifModelDesc},
+		Properties:       map[string]interface{}{"kind": "model", "threshold": threshold},
+	})
+
+	sarifResults := []sarifResult{}
+	for _, r := range results {
+		if r.Err != nil || (len(r.Hits) == 0 && r.Score < threshold) {
+			continue
+		}
+
+		uri := filepath.ToSlash(r.Path)
+		level := "warning"
+		if r.Score >= threshold {
+			level = "error"
+		}
+		res := sarifResult{
+			RuleID:    SarifModelRule,
+			RuleIndex: ruleIndex[SarifModelRule],
+			Level:     level,
+			Message:   sarifMessage{Text: fmt.Sprintf("%s scored %.2f, matched no rule", r.Path, r.Score)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}}},
+			Properties: map[string]interface{}{
+				"score":       r.Score,
+				"regexScore":  r.RegexScore,
+				"calculators": r.Calculators,
+			},
+		}
+		if len(r.Hits) == 0 {
+			sarifResults = append(sarifResults, res)
+			continue
+		}
+
+		primary := 0
+		for i, hit := range r.Hits {
+			if _, ok := ruleIndex[hit.Tag]; ok && tagScored[hit.Tag] > tagScored[r.Hits[primary].Tag] {
+				primary = i
+			}
+		}
+		hit := r.Hits[primary]
+		index, ok := ruleIndex[hit.Tag]
+		if !ok {
+			index = -1
+		}
+		res.RuleID = hit.Tag
+		res.RuleIndex = index
+		res.Message = sarifMessage{Text: fmt.Sprintf("%s scored %.2f, matched %s", r.Path, r.Score, describeHit(hit))}
+		res.Locations = []sarifLocation{sarifLocationOf(uri, hit, nil)}
+		for i, h := range r.Hits {
+			if i == primary {
+				continue
+			}
+			id := len(res.RelatedLocations)
+			res.RelatedLocations = append(res.RelatedLocations, sarifLocationOf(uri, h, &id))
+		}
+		sarifResults = append(sarifResults, res)
+	}
+
+	log := sarifLog{
+		Schema:  SarifSchema,
+		Version: SarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           ToolName,
+				InformationURI: ToolURI,
+				Rules:          rules,
+			}},
+			Results: sarifResults,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func describeHit(hit core.Hit) string {
+	desc := hit.Tag
+	if len(hit.Trace) > 0 {
+		desc = fmt.Sprintf("%s via %s", desc, strings.Join(hit.Trace, " -> "))
+	}
+	if len(hit.Decoders) == 0 {
+		return desc
+	}
+	return fmt.Sprintf("%s (decoded by %s)", desc, strings.Join(hit.Decoders, " -> "))
+}
+
+func sarifLocationOf(uri string, hit core.Hit, id *int) sarifLocation {
+	location := sarifLocation{
+		ID: id,
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: uri},
+			Region:           &sarifRegion{StartLine: hit.Line},
+		},
+	}
+	// 解码层的内容不在原文件中，只标记行号
+	if len(hit.Decoders) == 0 {
+		location.PhysicalLocation.Region.Snippet = &sarifMessage{Text: hit.Snippet}
+	}
+	if id != nil {
+		location.Message = &sarifMessage{Text: describeHit(hit)}
+	}
+	return location
+}
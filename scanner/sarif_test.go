@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"wxel/core"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// testdata/sarif-schema-2.1.0.json为OASIS发布的SARIF 2.1.0（errata01）JSON Schema
+func TestWriteSARIFSchema(t *testing.T) {
+	schema, err := jsonschema.Compile("testdata/sarif-schema-2.1.0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*Result
+	err = s.ScanPath("../sample/webshell", func(r *Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 包含解码链、污点路径、扩展名不符及读取失败的结果
+	contents := map[string]string{
+		"decoded.php": `<?php eval(base64_decode('ZXZhbCgkX1BPU1RbJ2MnXSk7'));`,
+		"taint.php":   "<?php\n$a = $_GET['c'];\n$b = $a;\nsystem($b);\n",
+		"image.jpg":   "<?php @eval($_POST['x']); ?>",
+	}
+	for name, content := range contents {
+		results = append(results, s.ScanContent([]byte(content), name)...)
+	}
+	results = append(results, &Result{Path: "missing.php", Err: os.ErrNotExist})
+
+	var buf bytes.Buffer
+	if err := s.WriteSARIF(&buf, results, 0); err != nil {
+		t.Fatal(err)
+	}
+	var log interface{}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(log); err != nil {
+		t.Fatalf("SARIF log does not match the schema: %#v", err)
+	}
+	if n := len(log.(map[string]interface{})["runs"].([]interface{})[0].(map[string]interface{})["results"].([]interface{})); n == 0 {
+		t.Fatal("no result in SARIF log")
+	}
+}
+
+type sarifTestResult struct {
+	RuleID    string `json:"ruleId"`
+	Level     string `json:"level"`
+	Locations []struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+	} `json:"locations"`
+}
+
+// 仅由模型得分告警的文件同样输出结果，级别按阈值区分
+func TestWriteSARIFThreshold(t *testing.T) {
+	schema, err := jsonschema.Compile("testdata/sarif-schema-2.1.0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit := core.Hit{Plugin: "php", Tag: "php/execution", Snippet: " eval(", Line: 1}
+	results := []*Result{
+		{Path: "model.php", Score: 85},
+		{Path: "low.php", Score: 40},
+		{Path: "rule.php", Score: 60, Hits: []core.Hit{hit}},
+		{Path: "weak.php", Score: 10, Hits: []core.Hit{hit}},
+	}
+	tests := []struct {
+		threshold float64
+		want      map[string]string // 文件 -> 规则及级别
+	}{
+		{0, map[string]string{
+			"model.php": SarifModelRule + " error",
+			"rule.php":  "php/execution error",
+			"weak.php":  "php/execution warning",
+		}},
+		{70, map[string]string{
+			"model.php": SarifModelRule + " error",
+			"rule.php":  "php/execution warning",
+			"weak.php":  "php/execution warning",
+		}},
+		{30, map[string]string{
+			"model.php": SarifModelRule + " error",
+			"low.php":   SarifModelRule + " error",
+			"rule.php":  "php/execution error",
+			"weak.php":  "php/execution warning",
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := s.WriteSARIF(&buf, results, tt.threshold); err != nil {
+			t.Fatal(err)
+		}
+		var log interface{}
+		if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+			t.Fatal(err)
+		}
+		if err := schema.Validate(log); err != nil {
+			t.Fatalf("threshold %v: SARIF log does not match the schema: %#v", tt.threshold, err)
+		}
+		var parsed struct {
+			Runs []struct {
+				Results []sarifTestResult `json:"results"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, r := range parsed.Runs[0].Results {
+			got[r.Locations[0].PhysicalLocation.ArtifactLocation.URI] = r.RuleID + " " + r.Level
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("threshold %v: results %v, want %v", tt.threshold, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/patrikeh/go-deep"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"wxel/core"
+)
+
+const (
+	MaxFileSize = 10 * 1024 * 1024
+)
+
+type Result struct {
+	Path        string             `json:"path"`
+	Score       float64            `json:"score"`       // 模型预测得分（0-100）
+	RegexScore  float64            `json:"regex_score"` // 插件规则得分
+	Calculators map[string]float64 `json:"calculators"` // 各计算器归一化后的值
+	Hits        []core.Hit         `json:"hits,omitempty"`
+	Layers      *core.Layer        `json:"layers,omitempty"`        // 解码树，无解码层时为空
+	Chains      []string           `json:"decode_chains,omitempty"` // 解码树中每个叶子节点的解码链
+	Features    []float64          `json:"-"`                       // 正则得分及各计算器的值，即模型输入
+	Matches     map[string]int32   `json:"-"`
+	Err         error              `json:"-"`
+}
+
+type Option func(*Scanner)
+
+type Scanner struct {
+	model        *deep.Neural
+	featuresOnly bool
+	plugins      []*core.Plugin
+	calculators  []*core.Calculator
+	maxFileSize  int64
+	workers      int
+	// 是否展开压缩包，及压缩包的大小、嵌套层数、文件数、解压后总字节数及压缩比例限制
+	archives      bool
+	archiveLimits ArchiveLimits
+	cache         *Cache
+
+	// go-deep在预测时会修改神经元状态，需要串行调用
+	mu sync.Mutex
+}
+
+func WithModel(dn *deep.Neural) Option {
+	return func(s *Scanner) {
+		s.model = dn
+	}
+}
+
+// 只计算特征不加载模型，用于生成训练样本
+func WithFeaturesOnly() Option {
+	return func(s *Scanner) {
+		s.featuresOnly = true
+	}
+}
+
+func WithPlugins(plugins []*core.Plugin) Option {
+	return func(s *Scanner) {
+		s.plugins = plugins
+	}
+}
+
+func WithCalculators(calculators []*core.Calculator) Option {
+	return func(s *Scanner) {
+		s.calculators = calculators
+	}
+}
+
+func WithMaxFileSize(size int64) Option {
+	return func(s *Scanner) {
+		s.maxFileSize = size
+	}
+}
+
+// 并发检测文件的goroutine数量
+func WithWorkers(n int) Option {
+	return func(s *Scanner) {
+		s.workers = n
+	}
+}
+
+func New(opts ...Option) (*Scanner, error) {
+	s := &Scanner{
+		plugins:       core.GetPlugins(),
+		calculators:   core.GetCalculators(),
+		maxFileSize:   MaxFileSize,
+		workers:       runtime.NumCPU(),
+		archives:      true,
+		archiveLimits: DefaultArchiveLimits,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.workers <= 0 {
+		s.workers = 1
+	}
+
+	if s.featuresOnly {
+		s.model = nil
+		s.initCache()
+		return s, nil
+	}
+
+	if s.model == nil {
+		dn, err := ParseModel([]byte(ModuleContent))
+		if err != nil {
+			return nil, err
+		}
+		s.model = dn
+	}
+
+	// 模型输入为正则得分加上每个计算器的值
+	inputs := len(s.calculators) + 1
+	if s.model.Config.Inputs != inputs {
+		return nil, fmt.Errorf("module expects %d inputs, but scanner produces %d features", s.model.Config.Inputs, inputs)
+	}
+	s.initCache()
+
+	return s, nil
+}
+
+func (s *Scanner) initCache() {
+	if s.cache != nil {
+		s.cache.setVersion(s.Fingerprint())
+	}
+}
+
+func (s *Scanner) Features(content, filename string) (*core.MatchResult, []float64) {
+	mr := core.CheckRegexMatches(s.plugins, content, filename)
+	features := []float64{mr.Score}
+	for _, calculator := range s.calculators {
+		features = append(features, calculator.UniformizationResult(mr, content))
+	}
+	return mr, features
+}
+
+func (s *Scanner) scan(content []byte, filename string) *Result {
+	// class文件检测其常量池中的字符串
+	if core.IsClassFile(content) {
+		if strs, err := core.JavaClassStrings(content); err == nil {
+			content = strs
+		}
+	}
+	mr, features := s.Features(string(content), filename)
+	r := &Result{
+		Path:        filename,
+		RegexScore:  mr.Score,
+		Calculators: make(map[string]float64),
+		Hits:        mr.Hits,
+		Features:    features,
+		Matches:     mr.Matches,
+	}
+	if len(mr.Root.Children) > 0 {
+		r.Layers = mr.Root
+		r.Chains = leafChains(mr.Root)
+	}
+	for i, calculator := range s.calculators {
+		name := calculator.Name
+		if name == "" {
+			name = fmt.Sprintf("calculator_%d", i)
+		}
+		r.Calculators[name] = features[i+1]
+	}
+	if s.model != nil {
+		s.mu.Lock()
+		r.Score = s.model.Predict(features)[0] * 100
+		s.mu.Unlock()
+	}
+	return r
+}
+
+func leafChains(l *core.Layer) []string {
+	if len(l.Children) == 0 {
+		return []string{l.String()}
+	}
+	var chains []string
+	for _, c := range l.Children {
+		chains = append(chains, leafChains(c)...)
+	}
+	return chains
+}
+
+func (s *Scanner) ScanReader(reader io.Reader, filename string) (*Result, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(reader, s.maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > s.maxFileSize {
+		return nil, fmt.Errorf("content of %s exceeds %d bytes", filename, s.maxFileSize)
+	}
+	return s.scan(content, filename), nil
+}
+
+func (s *Scanner) ScanFile(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	return s.ScanReader(f, path)
+}
+
+type job struct {
+	index int
+	path  string
+	err   error
+}
+
+type done struct {
+	index   int
+	results []*Result
+}
+
+func (s *Scanner) sizeLimit(path string) int64 {
+	if s.isArchive(path) {
+		return s.archiveLimits.MaxSize
+	}
+	return s.maxFileSize
+}
+
+// 扫描文件或目录，超过大小限制及非常规文件会被忽略，读取失败的文件通过Result.Err返回。
+// 压缩包中的每个文件分别返回一个结果，路径形如 a.war!/WEB-INF/shell.jsp。
+// 文件由多个goroutine并发检测，fn按遍历顺序依次调用，同时处理中的文件数量不超过workers的两倍
+func (s *Scanner) ScanPath(root string, fn func(*Result)) error {
+	f, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !f.IsDir() {
+		if !f.Mode().IsRegular() || f.Size() >= s.sizeLimit(root) {
+			return fmt.Errorf("invalid scan object: %s", root)
+		}
+		for _, r := range s.scanFile(root) {
+			fn(r)
+		}
+		return nil
+	}
+
+	jobs := make(chan job)
+	results := make(chan done, s.workers)
+	tokens := make(chan struct{}, s.workers*2)
+
+	var walkErr error
+	go func() {
+		defer close(jobs)
+		index := 0
+		walkErr = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil {
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				if info, err := d.Info(); err != nil || info.Size() >= s.sizeLimit(path) {
+					return nil
+				}
+			}
+			tokens <- struct{}{}
+			jobs <- job{index: index, path: path, err: err}
+			index++
+			return nil
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if j.err != nil {
+					results <- done{index: j.index, results: []*Result{{Path: j.path, Err: j.err}}}
+					continue
+				}
+				results <- done{index: j.index, results: s.scanFile(j.path)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	next := 0
+	pending := make(map[int][]*Result)
+	for d := range results {
+		pending[d.index] = d.results
+		for {
+			rs, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			for _, r := range rs {
+				fn(r)
+			}
+			next++
+			<-tokens
+		}
+	}
+
+	return walkErr
+}
+
+func (s *Scanner) scanFile(path string) []*Result {
+	if s.cache != nil {
+		return s.scanCachedFile(path)
+	}
+	if s.isArchive(path) {
+		return s.scanArchiveFile(path)
+	}
+	r, err := s.ScanFile(path)
+	if err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+	return []*Result{r}
+}
+
+// 读取文件内容，超过大小限制时返回错误
+func (s *Scanner) readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	limit := s.sizeLimit(path)
+	content, err := ioutil.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("content of %s exceeds %d bytes", path, limit)
+	}
+	return content, nil
+}
+
+// 检测已读取的文件内容，name为文件名，用于判断文件类型及是否为压缩包，
+// 压缩包中的每个文件分别返回一个结果
+func (s *Scanner) ScanContent(content []byte, path string) []*Result {
+	return s.ScanContentContext(context.Background(), content, path)
+}
+
+// 与ScanContent相同，ctx结束时不再检测压缩包中剩余的文件，并返回ctx.Err()作为错误
+func (s *Scanner) ScanContentContext(ctx context.Context, content []byte, path string) []*Result {
+	if err := ctx.Err(); err != nil {
+		return []*Result{{Path: path, Err: err}}
+	}
+	if s.isArchive(path) {
+		return s.scanArchiveContent(ctx, content, path)
+	}
+	if int64(len(content)) > s.maxFileSize {
+		return []*Result{{Path: path, Err: fmt.Errorf("content of %s exceeds %d bytes", path, s.maxFileSize)}}
+	}
+	return []*Result{s.scan(content, path)}
+}
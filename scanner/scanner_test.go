@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// 对比单个worker与多个worker检测sample目录的耗时，多个worker时与CPU数量相同，至少为2
+func BenchmarkScanPath(b *testing.B) {
+	n := runtime.NumCPU()
+	if n < 2 {
+		n = 2
+	}
+	for _, workers := range []int{1, n} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			s, err := New(WithWorkers(workers))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				files := 0
+				err := s.ScanPath("../sample", func(r *Result) {
+					if r.Err != nil {
+						b.Errorf("scan %s error: %v", r.Path, r.Err)
+					}
+					files++
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if files == 0 {
+					b.Fatal("no file scanned")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 文件在该时间内没有新的写入才检测，合并上传、解压等连续写入产生的事件
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+var errWatchOverflow = errors.New("too many filesystem events, some changes may be missed")
+
+// 各平台的文件系统监控，Events返回新建或修改的文件，新建的子目录由实现自行监控
+type fsWatcher interface {
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// 监控目录（包括之后新建的子目录），新建或修改的文件在debounce时间内没有新的写入后检测，
+// 结果通过fn返回，fn不会被并发调用。ctx结束时停止监控并等待检测中的文件完成
+func (s *Scanner) Watch(ctx context.Context, root string, debounce time.Duration, fn func(*Result)) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid watch object: %s is not a directory", root)
+	}
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	w, err := newWatcher(root)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+
+	var mu sync.Mutex
+	report := func(r *Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(r)
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				// 检测前文件可能已被删除或替换为其他类型
+				info, err := os.Lstat(path)
+				if err != nil || !info.Mode().IsRegular() || info.Size() >= s.sizeLimit(path) {
+					continue
+				}
+				for _, r := range s.scanFile(path) {
+					report(r)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	tick := debounce / 2
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	pending := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case path := <-w.Events():
+			pending[path] = time.Now()
+		case err := <-w.Errors():
+			report(&Result{Path: root, Err: err})
+		case now := <-ticker.C:
+			for path, last := range pending {
+				if now.Sub(last) < debounce {
+					continue
+				}
+				delete(pending, path)
+				select {
+				case jobs <- path:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+//go:build linux
+
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	inotifyDirMask  = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+	inotifyFileMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY
+)
+
+// 基于inotify的递归监控，每个目录一个watch，新建或移入的目录会被加入监控，其中已有的文件作为新文件返回
+type inotifyWatcher struct {
+	file   *os.File
+	fd     int
+	mu     sync.Mutex
+	dirs   map[int]string // watch描述符到目录
+	events chan string
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newWatcher(root string) (fsWatcher, error) {
+	// 非阻塞的描述符由runtime poller管理，Close时可以中断Read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init error: %v", err)
+	}
+	w := &inotifyWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dirs:   make(map[int]string),
+		events: make(chan string),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+	}
+	if err := w.addWatch(root); err != nil {
+		_ = w.file.Close()
+		return nil, err
+	}
+	go func() {
+		w.addTree(root, false)
+		w.readEvents()
+	}()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *inotifyWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+	})
+	return err
+}
+
+func (w *inotifyWatcher) addWatch(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyDirMask)
+	if err != nil {
+		// 超出fs.inotify.max_user_watches时返回ENOSPC
+		return fmt.Errorf("watch %s error: %v", dir, err)
+	}
+	w.mu.Lock()
+	w.dirs[wd] = dir
+	w.mu.Unlock()
+	return nil
+}
+
+// 监控dir下的所有子目录，emit为true时将其中已有的文件作为新文件返回
+func (w *inotifyWatcher) addTree(dir string, emit bool) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir || emit {
+				if err := w.addWatch(path); err != nil {
+					w.sendError(err)
+				}
+			}
+			return nil
+		}
+		if emit && d.Type().IsRegular() {
+			w.send(path)
+		}
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) send(path string) {
+	select {
+	case w.events <- path:
+	case <-w.done:
+	}
+}
+
+func (w *inotifyWatcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	case <-w.done:
+	}
+}
+
+func (w *inotifyWatcher) readEvents() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendError(fmt.Errorf("read inotify events error: %v", err))
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(ev.Len)
+			if end > n {
+				break
+			}
+			w.handle(int(ev.Wd), ev.Mask, strings.TrimRight(string(buf[start:end]), "\x00"))
+			offset = end
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.sendError(errWatchOverflow)
+		return
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	// 目录被删除或移出后watch会自动移除
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 {
+		if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			w.addTree(path, true)
+		}
+		return
+	}
+	if mask&inotifyFileMask != 0 {
+		w.send(path)
+	}
+}
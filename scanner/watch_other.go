@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+import "errors"
+
+func newWatcher(root string) (fsWatcher, error) {
+	return nil, errors.New("watch mode is only supported on linux")
+}
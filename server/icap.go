@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ICAP（RFC 3507）服务，代理通过REQMOD提交上传请求、通过RESPMOD提交下载的响应，
+// 检测其中的文件后返回204（不修改）或403的阻断响应
+const (
+	DefaultICAPListen = ":1344"
+
+	icapReqmodService  = "/reqmod"
+	icapRespmodService = "/respmod"
+	icapIdleTimeout    = 60 * time.Second
+	// ICAP请求头、封装的HTTP请求头及响应头各自的长度上限
+	icapMaxHeaderBytes = 64 * 1024
+	// 每个检测位置对应的连接数，超过时返回503
+	icapConnsPerSlot = 4
+)
+
+var errICAPBadRequest = errors.New("bad icap request")
+
+// 报文体超过-max-size时的处理方式
+const (
+	icapOversizeBlock = "block" // 返回403
+	icapOversizeScan  = "scan"  // 只检测前-max-size字节
+)
+
+// 检测出错（如压缩包超出限制）且未发现webshell时的处理方式
+const (
+	icapScanErrorBlock = "block" // 返回403
+	icapScanErrorAllow = "allow" // 与未发现webshell相同
+)
+
+type icapServer struct {
+	sv        *server
+	istag     string
+	oversize  string
+	scanError string
+	maxConns  int
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*icapConn]bool
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+type icapConn struct {
+	conn net.Conn
+	lr   *io.LimitedReader // 读取ICAP请求头时限制长度
+	br   *bufio.Reader
+	bw   *bufio.Writer
+	idle bool
+}
+
+// 封装在ICAP请求中的HTTP报文
+type icapRequest struct {
+	method  string
+	service string
+	header  textproto.MIMEHeader
+	reqHdr  []byte // 原始的HTTP请求头
+	resHdr  []byte // 原始的HTTP响应头
+	body    []byte
+	content []byte // 按Content-Encoding解压后的报文体
+	hasBody bool
+	tooLong bool // 报文体或解压后的内容超过大小限制，只保留前maxSize字节
+	cut     bool // 报文体本身被截断，放行时无法原样返回
+	preview bool // 预览已包含全部内容，未返回100 Continue
+}
+
+func newICAPServer(sv *server, oversize string, scanError string) *icapServer {
+	return &icapServer{
+		sv:        sv,
+		oversize:  oversize,
+		scanError: scanError,
+		maxConns:  cap(sv.slots) * icapConnsPerSlot,
+		// 插件、模型等变化时ISTag随之变化，代理据此使缓存的结果失效
+		istag: fmt.Sprintf("\"wxel-%s\"", sv.scanner.Fingerprint()[:16]),
+		conns: make(map[*icapConn]bool),
+	}
+}
+
+func (is *icapServer) Serve(ln net.Listener) error {
+	is.mu.Lock()
+	is.listener = ln
+	is.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			is.mu.Lock()
+			closing := is.closing
+			is.mu.Unlock()
+			if closing {
+				return nil
+			}
+			return err
+		}
+		c := &icapConn{conn: conn}
+		is.mu.Lock()
+		if is.closing {
+			is.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		if len(is.conns) >= is.maxConns {
+			is.mu.Unlock()
+			go is.reject(conn)
+			continue
+		}
+		is.conns[c] = true
+		is.wg.Add(1)
+		is.mu.Unlock()
+		go is.serveConn(c)
+	}
+}
+
+// 停止接受新连接并关闭空闲连接，等待处理中的请求完成，ctx结束时关闭所有连接
+func (is *icapServer) Shutdown(ctx context.Context) error {
+	is.mu.Lock()
+	is.closing = true
+	if is.listener != nil {
+		_ = is.listener.Close()
+	}
+	for c := range is.conns {
+		if c.idle {
+			_ = c.conn.Close()
+		}
+	}
+	is.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		is.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		is.mu.Lock()
+		for c := range is.conns {
+			_ = c.conn.Close()
+		}
+		is.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// 连接数达到Max-Connections时返回503后断开
+func (is *icapServer) reject(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	bw := bufio.NewWriter(conn)
+	is.sv.metrics.icapRequest("UNKNOWN", 503)
+	if err := is.writeStatus(bw, 503, "Service Unavailable", true); err == nil {
+		_ = bw.Flush()
+	}
+}
+
+// 连接空闲时可以在关闭服务时直接断开，返回false表示服务正在关闭
+func (is *icapServer) setIdle(c *icapConn, idle bool) bool {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	c.idle = idle
+	return !is.closing
+}
+
+func (is *icapServer) serveConn(c *icapConn) {
+	defer func() {
+		// 处理请求时的panic只断开当前连接
+		if err := recover(); err != nil {
+			fmt.Fprintf(os.Stderr, "icap panic serving %v: %v\n%s", c.conn.RemoteAddr(), err, debug.Stack())
+		}
+		is.mu.Lock()
+		delete(is.conns, c)
+		is.mu.Unlock()
+		_ = c.conn.Close()
+		is.wg.Done()
+	}()
+
+	c.lr = &io.LimitedReader{R: c.conn}
+	c.br = bufio.NewReader(c.lr)
+	c.bw = bufio.NewWriter(c.conn)
+	for {
+		if !is.setIdle(c, true) {
+			return
+		}
+		c.lr.N = icapMaxHeaderBytes
+		_ = c.conn.SetReadDeadline(time.Now().Add(icapIdleTimeout))
+		if _, err := c.br.Peek(1); err != nil {
+			return
+		}
+		if !is.setIdle(c, false) {
+			return
+		}
+		// 与HTTP服务相同，读取请求最长-read-timeout，到写完响应最长-write-timeout
+		start := time.Now()
+		_ = c.conn.SetReadDeadline(start.Add(is.sv.readTimeout))
+		_ = c.conn.SetWriteDeadline(start.Add(is.sv.writeTimeout))
+		ctx, cancel := context.WithDeadline(context.Background(), start.Add(is.sv.writeTimeout))
+		keepAlive, err := is.handle(ctx, c)
+		cancel()
+		if err == nil {
+			err = c.bw.Flush()
+		}
+		if err != nil || !keepAlive {
+			return
+		}
+	}
+}
+
+// 处理一个ICAP请求，返回是否可以继续在该连接上处理请求
+func (is *icapServer) handle(ctx context.Context, c *icapConn) (bool, error) {
+	bw := c.bw
+	req, err := is.readRequest(c)
+	if err != nil {
+		// 连接已断开或读取出错时无法返回响应
+		var netErr net.Error
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+			return false, err
+		}
+		is.sv.metrics.icapRequest(req.methodOrUnknown(), 400)
+		return false, is.writeStatus(bw, 400, "Bad Request", true)
+	}
+
+	switch {
+	case req.method == "OPTIONS":
+		if req.service != icapReqmodService && req.service != icapRespmodService {
+			is.sv.metrics.icapRequest(req.method, 404)
+			return true, is.writeStatus(bw, 404, "ICAP Service Not Found", false)
+		}
+		is.sv.metrics.icapRequest(req.method, 200)
+		return true, is.writeOptions(bw, req.service)
+	case req.method == "REQMOD" && req.service == icapReqmodService,
+		req.method == "RESPMOD" && req.service == icapRespmodService:
+	case req.method == "REQMOD" || req.method == "RESPMOD":
+		is.sv.metrics.icapRequest(req.method, 404)
+		return true, is.writeStatus(bw, 404, "ICAP Service Not Found", false)
+	default:
+		is.sv.metrics.icapRequest(req.methodOrUnknown(), 405)
+		return true, is.writeStatus(bw, 405, "Method Not Allowed", false)
+	}
+
+	// 无法解压的内容不能确认是否安全，直接阻断
+	target, header := req.httpHeader()
+	if err := req.decode(header, is.sv.maxSize); err != nil {
+		is.sv.metrics.icapRequest(req.method, 200)
+		return true, is.block(bw, map[string]string{"error": err.Error()})
+	}
+	// 不检测超过大小限制的报文会被用来绕过检测
+	if req.tooLong && is.oversize == icapOversizeBlock {
+		is.sv.metrics.icapRequest(req.method, 200)
+		return true, is.block(bw, map[string]string{"error": fmt.Sprintf("content exceeds %d bytes", is.sv.maxSize)})
+	}
+	uploads := req.uploads(target, header)
+	if len(uploads) == 0 {
+		return true, is.allow(bw, req)
+	}
+	if err := is.sv.acquire(ctx); err != nil {
+		is.sv.metrics.icapRequest(req.method, 500)
+		return false, is.writeStatus(bw, 500, "Server Error", true)
+	}
+	resp, err := is.sv.scan(ctx, uploads, is.sv.threshold)
+	is.sv.release()
+	if err != nil {
+		is.sv.metrics.icapRequest(req.method, 500)
+		return false, is.writeStatus(bw, 500, "Server Error", true)
+	}
+	if !resp.Detected && (is.scanError == icapScanErrorAllow || !resp.failed()) {
+		return true, is.allow(bw, req)
+	}
+	is.sv.metrics.icapRequest(req.method, 200)
+	return true, is.block(bw, resp)
+}
+
+// 是否有文件检测出错
+func (r *scanResponse) failed() bool {
+	for _, v := range r.Files {
+		if len(v.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 指标中只区分已知的方法
+func (r *icapRequest) methodOrUnknown() string {
+	if r != nil && (r.method == "OPTIONS" || r.method == "REQMOD" || r.method == "RESPMOD") {
+		return r.method
+	}
+	return "UNKNOWN"
+}
+
+func (is *icapServer) readRequest(c *icapConn) (*icapRequest, error) {
+	br, bw := c.br, c.bw
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, c.headerError(err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "ICAP/") {
+		return nil, fmt.Errorf("%w: invalid request line %q", errICAPBadRequest, line)
+	}
+	u, err := url.Parse(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid uri %q", errICAPBadRequest, fields[1])
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, c.headerError(err)
+	}
+	// 封装的HTTP头部的长度单独检查，报文体的每一行不超过缓冲区大小
+	c.lr.N = math.MaxInt64
+	req := &icapRequest{method: fields[0], service: u.Path, header: header}
+	if req.method == "OPTIONS" {
+		return req, nil
+	}
+
+	sections, err := parseEncapsulated(header.Get("Encapsulated"))
+	if err != nil {
+		return req, err
+	}
+	// 除最后的报文体外，各部分按偏移依次排列
+	offset := 0
+	for i, sec := range sections {
+		if sec.offset != offset {
+			return req, fmt.Errorf("%w: invalid encapsulated offset %d", errICAPBadRequest, sec.offset)
+		}
+		if strings.HasSuffix(sec.name, "-body") {
+			if i != len(sections)-1 {
+				return req, fmt.Errorf("%w: body is not the last encapsulated section", errICAPBadRequest)
+			}
+			req.hasBody = sec.name != "null-body"
+			break
+		}
+		if i == len(sections)-1 {
+			return req, fmt.Errorf("%w: encapsulated body section is missing", errICAPBadRequest)
+		}
+		// 偏移由客户端指定，超过上限时不分配内存
+		if sections[i+1].offset > icapMaxHeaderBytes {
+			return req, fmt.Errorf("%w: encapsulated headers exceed %d bytes", errICAPBadRequest, icapMaxHeaderBytes)
+		}
+		data := make([]byte, sections[i+1].offset-sec.offset)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return req, err
+		}
+		switch sec.name {
+		case "req-hdr":
+			req.reqHdr = data
+		case "res-hdr":
+			req.resHdr = data
+		}
+		offset = sections[i+1].offset
+	}
+	if !req.hasBody {
+		return req, nil
+	}
+
+	// 代理先发送预览，未包含全部内容时需要返回100 Continue获取其余部分
+	ieof, err := is.readChunks(br, req)
+	if err != nil {
+		return req, err
+	}
+	req.preview = req.header.Get("Preview") != "" && ieof
+	if req.header.Get("Preview") != "" && !ieof {
+		if _, err := bw.WriteString("ICAP/1.0 100 Continue\r\n\r\n"); err != nil {
+			return req, err
+		}
+		if err := bw.Flush(); err != nil {
+			return req, err
+		}
+		if _, err := is.readChunks(br, req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// ICAP请求头超过长度上限时连接读到EOF，此时返回400而不是直接断开
+func (c *icapConn) headerError(err error) error {
+	if c.lr.N <= 0 {
+		return fmt.Errorf("%w: icap header exceeds %d bytes", errICAPBadRequest, icapMaxHeaderBytes)
+	}
+	return err
+}
+
+type encapsulatedSection struct {
+	name   string
+	offset int
+}
+
+func parseEncapsulated(value string) ([]encapsulatedSection, error) {
+	var sections []encapsulatedSection
+	for _, item := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: invalid encapsulated header %q", errICAPBadRequest, value)
+		}
+		switch kv[0] {
+		case "req-hdr", "res-hdr", "req-body", "res-body", "null-body", "opt-body":
+		default:
+			return nil, fmt.Errorf("%w: unknown encapsulated section %q", errICAPBadRequest, kv[0])
+		}
+		offset, err := strconv.Atoi(kv[1])
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("%w: invalid encapsulated header %q", errICAPBadRequest, value)
+		}
+		sections = append(sections, encapsulatedSection{name: kv[0], offset: offset})
+	}
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].offset < sections[j].offset
+	})
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("%w: encapsulated header is missing", errICAPBadRequest)
+	}
+	return sections, nil
+}
+
+// 读取chunked编码的报文体直到长度为0的块，返回该块是否带有ieof扩展（预览已包含全部内容）。
+// 超过大小限制的部分被丢弃
+func (is *icapServer) readChunks(br *bufio.Reader, req *icapRequest) (bool, error) {
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return false, err
+		}
+		sizeText, ext := line, ""
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			sizeText, ext = line[:i], line[i+1:]
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeText), 16, 64)
+		if err != nil || size < 0 {
+			return false, fmt.Errorf("%w: invalid chunk size %q", errICAPBadRequest, line)
+		}
+		if size == 0 {
+			// 跳过trailer直到空行
+			for {
+				l, err := readLine(br)
+				if err != nil {
+					return false, err
+				}
+				if l == "" {
+					break
+				}
+			}
+			return strings.TrimSpace(ext) == "ieof", nil
+		}
+
+		// 超过大小限制的部分读取后丢弃
+		keep := is.sv.maxSize - int64(len(req.body))
+		if size > keep {
+			req.tooLong, req.cut = true, true
+		} else {
+			keep = size
+		}
+		chunk := make([]byte, keep)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return false, err
+		}
+		req.body = append(req.body, chunk...)
+		if _, err := io.CopyN(ioutil.Discard, br, size-keep); err != nil {
+			return false, err
+		}
+		if l, err := readLine(br); err != nil || l != "" {
+			if err == nil {
+				err = fmt.Errorf("%w: chunk is not terminated by CRLF", errICAPBadRequest)
+			}
+			return false, err
+		}
+	}
+}
+
+// 读取分块的大小及trailer，一行不能超过bufio.Reader的缓冲区
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: line exceeds %d bytes", errICAPBadRequest, br.Size())
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// 封装的HTTP请求的路径，以及REQMOD的请求头或RESPMOD的响应头
+func (r *icapRequest) httpHeader() (string, http.Header) {
+	var header http.Header
+	target := ""
+	if r.reqHdr != nil {
+		if req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(r.reqHdr))); err == nil {
+			target = req.URL.Path
+			if r.method == "REQMOD" {
+				header = req.Header
+			}
+		}
+	}
+	if r.method == "RESPMOD" && r.resHdr != nil {
+		if resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.resHdr)), nil); err == nil {
+			header = resp.Header
+		}
+	}
+	return target, header
+}
+
+// 按Content-Encoding依次解压报文体，报文体已被截断时检测能解压的部分，
+// 解压后超过maxSize时截断并标记tooLong。原来的报文体不变，放行时原样返回
+func (r *icapRequest) decode(header http.Header, maxSize int64) error {
+	r.content = r.body
+	if header == nil || len(r.body) == 0 {
+		return nil
+	}
+	var codings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	// 最后使用的编码最先解压
+	for i := len(codings) - 1; i >= 0; i-- {
+		var zr io.Reader
+		var err error
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			zr, err = gzip.NewReader(bytes.NewReader(r.content))
+		case "deflate":
+			// 按规范为zlib格式，部分服务器使用不带头部的deflate
+			zr, err = zlib.NewReader(bytes.NewReader(r.content))
+			if err != nil {
+				zr, err = flate.NewReader(bytes.NewReader(r.content)), nil
+			}
+		default:
+			return fmt.Errorf("unsupported content encoding %s", codings[i])
+		}
+		if err != nil {
+			return fmt.Errorf("decode %s content error: %v", codings[i], err)
+		}
+		content, err := ioutil.ReadAll(io.LimitReader(zr, maxSize+1))
+		if err != nil && !(r.cut && errors.Is(err, io.ErrUnexpectedEOF)) {
+			return fmt.Errorf("decode %s content error: %v", codings[i], err)
+		}
+		if int64(len(content)) > maxSize {
+			content = content[:maxSize]
+			r.tooLong = true
+		}
+		r.content = content
+	}
+	return nil
+}
+
+// 从封装的HTTP报文中取出需要检测的文件：multipart中的每个文件，
+// 或者整个报文体，文件名取自Content-Disposition或URL路径
+func (r *icapRequest) uploads(target string, header http.Header) []upload {
+	if len(r.content) == 0 {
+		return nil
+	}
+	name := path.Base(target)
+	if name == "." || name == "/" {
+		name = "upload"
+	}
+	if header != nil {
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			name = params["filename"]
+		}
+		mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" && params["boundary"] != "" {
+			uploads, err := multipartUploads(r.content, params["boundary"])
+			if err != nil {
+				// multipart格式错误（如缺少结束边界或被截断）时检测整个报文体，
+				// 否则不完整的部分不会被检测
+				uploads = append(uploads, upload{name: name, content: r.content})
+			}
+			return uploads
+		}
+	}
+	return []upload{{name: name, content: r.content}}
+}
+
+func multipartUploads(body []byte, boundary string) ([]upload, error) {
+	var uploads []upload
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return uploads, nil
+		}
+		if err != nil {
+			return uploads, err
+		}
+		// 只检测文件，忽略普通的表单字段
+		if part.FileName() == "" {
+			continue
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return uploads, err
+		}
+		uploads = append(uploads, upload{name: part.FileName(), content: content})
+	}
+}
+
+func (is *icapServer) writeHeader(bw *bufio.Writer, code int, reason string, header []string) error {
+	fmt.Fprintf(bw, "ICAP/1.0 %d %s\r\n", code, reason)
+	fmt.Fprintf(bw, "Date: %s\r\n", time.Now().UTC().Format(http.TimeFormat))
+	fmt.Fprintf(bw, "Server: wxel\r\n")
+	fmt.Fprintf(bw, "ISTag: %s\r\n", is.istag)
+	for _, h := range header {
+		fmt.Fprintf(bw, "%s\r\n", h)
+	}
+	_, err := bw.WriteString("\r\n")
+	return err
+}
+
+func (is *icapServer) writeStatus(bw *bufio.Writer, code int, reason string, close bool) error {
+	header := []string{"Encapsulated: null-body=0"}
+	if close {
+		header = append(header, "Connection: close")
+	}
+	return is.writeHeader(bw, code, reason, header)
+}
+
+func (is *icapServer) writeOptions(bw *bufio.Writer, service string) error {
+	method := "REQMOD"
+	if service == icapRespmodService {
+		method = "RESPMOD"
+	}
+	return is.writeHeader(bw, 200, "OK", []string{
+		"Methods: " + method,
+		"Service: WXEL webshell scanner",
+		"Allow: 204",
+		fmt.Sprintf("Max-Connections: %d", is.maxConns),
+		"Options-TTL: 3600",
+		"Encapsulated: null-body=0",
+	})
+}
+
+// 未发现webshell，代理允许204时直接返回，否则原样返回封装的报文
+func (is *icapServer) allow(bw *bufio.Writer, req *icapRequest) error {
+	// 代理未声明Allow: 204时，只有在预览阶段可以返回204
+	if strings.Contains(req.header.Get("Allow"), "204") || req.preview {
+		is.sv.metrics.icapRequest(req.method, 204)
+		return is.writeHeader(bw, 204, "No Content", []string{"Encapsulated: null-body=0"})
+	}
+	// 超过大小限制时报文体已被截断，只能要求代理使用原来的报文
+	if req.cut {
+		is.sv.metrics.icapRequest(req.method, 500)
+		return is.writeStatus(bw, 500, "Server Error", true)
+	}
+
+	is.sv.metrics.icapRequest(req.method, 200)
+	hdr, name := req.reqHdr, "req"
+	if req.method == "RESPMOD" {
+		hdr, name = req.resHdr, "res"
+	}
+	encapsulated := fmt.Sprintf("%s-hdr=0, %s-body=%d", name, name, len(hdr))
+	if !req.hasBody {
+		encapsulated = fmt.Sprintf("%s-hdr=0, null-body=%d", name, len(hdr))
+	}
+	if err := is.writeHeader(bw, 200, "OK", []string{"Encapsulated: " + encapsulated}); err != nil {
+		return err
+	}
+	if _, err := bw.Write(hdr); err != nil {
+		return err
+	}
+	if req.hasBody {
+		return writeChunked(bw, req.body)
+	}
+	return nil
+}
+
+// 返回403的HTTP响应替换原来的请求或响应，响应体为检测结果或错误
+func (is *icapServer) block(bw *bufio.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var hdr bytes.Buffer
+	fmt.Fprintf(&hdr, "HTTP/1.1 403 Forbidden\r\n")
+	fmt.Fprintf(&hdr, "Content-Type: application/json\r\n")
+	fmt.Fprintf(&hdr, "Content-Length: %d\r\n", len(body))
+	fmt.Fprintf(&hdr, "Cache-Control: no-store\r\n")
+	fmt.Fprintf(&hdr, "Connection: close\r\n\r\n")
+	encapsulated := fmt.Sprintf("Encapsulated: res-hdr=0, res-body=%d", hdr.Len())
+	if err := is.writeHeader(bw, 200, "OK", []string{encapsulated}); err != nil {
+		return err
+	}
+	if _, err := bw.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+	return writeChunked(bw, body)
+}
+
+func writeChunked(bw *bufio.Writer, data []byte) error {
+	if len(data) > 0 {
+		fmt.Fprintf(bw, "%x\r\n", len(data))
+		_, _ = bw.Write(data)
+		_, _ = bw.WriteString("\r\n")
+	}
+	_, err := bw.WriteString("0\r\n\r\n")
+	return err
+}
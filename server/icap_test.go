@@ -0,0 +1,477 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wxel/scanner"
+)
+
+const (
+	testShell  = `<?php @eval($_POST["x"]); ?>` + "\n"
+	testBenign = "just a picture\n"
+)
+
+type icapTestConfig struct {
+	maxSize     int64
+	concurrency int
+	oversize    string
+	scanError   string
+	options     []scanner.Option
+}
+
+// 在随机端口启动ICAP服务，测试结束时关闭
+func startICAP(t *testing.T, cfg icapTestConfig) (string, *icapServer) {
+	t.Helper()
+	if cfg.maxSize == 0 {
+		cfg.maxSize = scanner.MaxFileSize
+	}
+	if cfg.concurrency == 0 {
+		cfg.concurrency = 2
+	}
+	if cfg.oversize == "" {
+		cfg.oversize = icapOversizeBlock
+	}
+	if cfg.scanError == "" {
+		cfg.scanError = icapScanErrorBlock
+	}
+	s, err := scanner.New(append([]scanner.Option{scanner.WithMaxFileSize(cfg.maxSize)}, cfg.options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &server{
+		scanner:      s,
+		threshold:    DefaultThreshold,
+		maxSize:      cfg.maxSize,
+		slots:        make(chan struct{}, cfg.concurrency),
+		readTimeout:  5 * time.Second,
+		writeTimeout: 10 * time.Second,
+		metrics:      newMetrics(cfg.concurrency),
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := newICAPServer(sv, cfg.oversize, cfg.scanError)
+	go func() {
+		_ = is.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = is.Shutdown(ctx)
+	})
+	return ln.Addr().String(), is
+}
+
+// 模拟代理的ICAP客户端
+type icapClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+type icapResponse struct {
+	code   int
+	header textproto.MIMEHeader
+	http   string // 封装的HTTP头部
+	body   []byte
+}
+
+func dialICAP(t *testing.T, addr string) *icapClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &icapClient{t: t, conn: conn, br: bufio.NewReader(conn)}
+}
+
+func (c *icapClient) send(data []byte) {
+	c.t.Helper()
+	if _, err := c.conn.Write(data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *icapClient) read() *icapResponse {
+	c.t.Helper()
+	tp := textproto.NewReader(c.br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		c.t.Fatalf("read status line error: %v", err)
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		c.t.Fatalf("invalid status line %q", line)
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		c.t.Fatalf("invalid status line %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("read header error: %v", err)
+	}
+	resp := &icapResponse{code: code, header: header}
+	if code == 100 {
+		return resp
+	}
+	sections, err := parseEncapsulated(header.Get("Encapsulated"))
+	if err != nil {
+		c.t.Fatalf("invalid encapsulated header %q", header.Get("Encapsulated"))
+	}
+	last := sections[len(sections)-1]
+	hdr := make([]byte, last.offset)
+	if _, err := io.ReadFull(c.br, hdr); err != nil {
+		c.t.Fatalf("read encapsulated header error: %v", err)
+	}
+	resp.http = string(hdr)
+	if last.name != "null-body" {
+		if resp.body, err = ioutil.ReadAll(httputil.NewChunkedReader(c.br)); err != nil {
+			c.t.Fatalf("read encapsulated body error: %v", err)
+		}
+		if l, err := tp.ReadLine(); err != nil || l != "" {
+			c.t.Fatalf("chunked body is not terminated: %q %v", l, err)
+		}
+	}
+	return resp
+}
+
+func (r *icapResponse) blocked() bool {
+	return r.code == 200 && strings.HasPrefix(r.http, "HTTP/1.1 403 ")
+}
+
+func chunked(data []byte, ext string) []byte {
+	var b bytes.Buffer
+	if len(data) > 0 {
+		fmt.Fprintf(&b, "%x\r\n%s\r\n", len(data), data)
+	}
+	fmt.Fprintf(&b, "0%s\r\n\r\n", ext)
+	return b.Bytes()
+}
+
+type icapMessage struct {
+	method  string // 默认为REQMOD
+	allow   bool   // Allow: 204
+	preview int    // 大于0时发送Preview
+	httpHdr string
+	body    []byte
+}
+
+// 构造ICAP请求，预览时只包含预览部分，其余部分由rest返回
+func (m icapMessage) build() (msg []byte, rest []byte) {
+	method, service, section := m.method, icapReqmodService, "req"
+	if method == "" {
+		method = "REQMOD"
+	}
+	if method == "RESPMOD" {
+		service, section = icapRespmodService, "res"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s icap://127.0.0.1%s ICAP/1.0\r\nHost: 127.0.0.1\r\n", method, service)
+	if m.allow {
+		b.WriteString("Allow: 204\r\n")
+	}
+	if m.body == nil {
+		fmt.Fprintf(&b, "Encapsulated: %s-hdr=0, null-body=%d\r\n\r\n%s", section, len(m.httpHdr), m.httpHdr)
+		return b.Bytes(), nil
+	}
+	fmt.Fprintf(&b, "Encapsulated: %s-hdr=0, %s-body=%d\r\n", section, section, len(m.httpHdr))
+	if m.preview <= 0 {
+		b.WriteString("\r\n" + m.httpHdr)
+		b.Write(chunked(m.body, ""))
+		return b.Bytes(), nil
+	}
+	fmt.Fprintf(&b, "Preview: %d\r\n\r\n%s", m.preview, m.httpHdr)
+	if len(m.body) <= m.preview {
+		b.Write(chunked(m.body, "; ieof"))
+		return b.Bytes(), nil
+	}
+	b.Write(chunked(m.body[:m.preview], ""))
+	return b.Bytes(), chunked(m.body[m.preview:], "")
+}
+
+func (c *icapClient) do(m icapMessage) *icapResponse {
+	c.t.Helper()
+	msg, rest := m.build()
+	c.send(msg)
+	if rest == nil {
+		return c.read()
+	}
+	// 未包含全部内容的预览，服务需要返回100 Continue或直接给出结论
+	resp := c.read()
+	if resp.code != 100 {
+		return resp
+	}
+	c.send(rest)
+	return c.read()
+}
+
+func multipartBody(filename string, content string) (string, []byte) {
+	body := "--XyZ\r\nContent-Disposition: form-data; name=\"note\"\r\n\r\nhello\r\n" +
+		"--XyZ\r\nContent-Disposition: form-data; name=\"f\"; filename=\"" + filename + "\"\r\nContent-Type: application/octet-stream\r\n\r\n" +
+		content + "\r\n--XyZ--\r\n"
+	return "POST /upload HTTP/1.1\r\nHost: app\r\nContent-Type: multipart/form-data; boundary=XyZ\r\n\r\n", []byte(body)
+}
+
+func putRequest(name string) string {
+	return "PUT /files/" + name + " HTTP/1.1\r\nHost: app\r\n\r\n"
+}
+
+func TestICAPOptions(t *testing.T) {
+	addr, is := startICAP(t, icapTestConfig{concurrency: 3})
+	c := dialICAP(t, addr)
+	for _, tt := range []struct {
+		service string
+		code    int
+		methods string
+	}{
+		{icapReqmodService, 200, "REQMOD"},
+		{icapRespmodService, 200, "RESPMOD"},
+		{"/unknown", 404, ""},
+	} {
+		c.send([]byte("OPTIONS icap://127.0.0.1" + tt.service + " ICAP/1.0\r\nHost: 127.0.0.1\r\n\r\n"))
+		resp := c.read()
+		if resp.code != tt.code {
+			t.Fatalf("OPTIONS %s: code %d, want %d", tt.service, resp.code, tt.code)
+		}
+		if resp.header.Get("ISTag") != is.istag {
+			t.Errorf("OPTIONS %s: ISTag %q, want %q", tt.service, resp.header.Get("ISTag"), is.istag)
+		}
+		if tt.code != 200 {
+			continue
+		}
+		if got := resp.header.Get("Methods"); got != tt.methods {
+			t.Errorf("OPTIONS %s: Methods %q, want %q", tt.service, got, tt.methods)
+		}
+		if got := resp.header.Get("Allow"); got != "204" {
+			t.Errorf("OPTIONS %s: Allow %q, want 204", tt.service, got)
+		}
+		if got := resp.header.Get("Max-Connections"); got != "12" {
+			t.Errorf("OPTIONS %s: Max-Connections %q, want 12", tt.service, got)
+		}
+	}
+}
+
+func TestICAPReqmodMultipart(t *testing.T) {
+	addr, _ := startICAP(t, icapTestConfig{})
+	c := dialICAP(t, addr)
+	shellHdr, shellBody := multipartBody("shell.php", testShell)
+	benignHdr, benignBody := multipartBody("a.jpg", testBenign)
+
+	for _, allow := range []bool{true, false} {
+		if resp := c.do(icapMessage{allow: allow, httpHdr: shellHdr, body: shellBody}); !resp.blocked() {
+			t.Errorf("shell with Allow: 204 %t: code %d %q, want 403", allow, resp.code, resp.http)
+		} else if !bytes.Contains(resp.body, []byte(`"detected":true`)) {
+			t.Errorf("blocked response body %s should contain the scan result", resp.body)
+		}
+	}
+	if resp := c.do(icapMessage{allow: true, httpHdr: benignHdr, body: benignBody}); resp.code != 204 {
+		t.Errorf("benign with Allow: 204: code %d, want 204", resp.code)
+	}
+	// 代理未声明Allow: 204时原样返回封装的报文
+	resp := c.do(icapMessage{httpHdr: benignHdr, body: benignBody})
+	if resp.code != 200 || resp.http != benignHdr || !bytes.Equal(resp.body, benignBody) {
+		t.Errorf("benign without Allow: 204: code %d %q %q, want the original message", resp.code, resp.http, resp.body)
+	}
+	if resp := c.do(icapMessage{allow: true, httpHdr: "GET / HTTP/1.1\r\nHost: app\r\n\r\n"}); resp.code != 204 {
+		t.Errorf("null-body: code %d, want 204", resp.code)
+	}
+	if resp := c.do(icapMessage{allow: true, httpHdr: putRequest("x.php"), body: []byte(testShell)}); !resp.blocked() {
+		t.Errorf("PUT shell: code %d, want 403", resp.code)
+	}
+}
+
+func TestICAPPreview(t *testing.T) {
+	addr, _ := startICAP(t, icapTestConfig{})
+	c := dialICAP(t, addr)
+	shellHdr, shellBody := multipartBody("shell.php", testShell)
+	benignHdr, benignBody := multipartBody("a.jpg", testBenign)
+
+	tests := []struct {
+		name    string
+		msg     icapMessage
+		blocked bool
+	}{
+		// 预览包含全部内容（ieof）时即使未声明Allow: 204也可以返回204
+		{"ieof benign", icapMessage{preview: 4096, httpHdr: benignHdr, body: benignBody}, false},
+		{"ieof shell", icapMessage{preview: 4096, httpHdr: shellHdr, body: shellBody}, true},
+		{"continue benign", icapMessage{allow: true, preview: 10, httpHdr: benignHdr, body: benignBody}, false},
+		{"continue shell", icapMessage{allow: true, preview: 10, httpHdr: shellHdr, body: shellBody}, true},
+	}
+	for _, tt := range tests {
+		resp := c.do(tt.msg)
+		if tt.blocked && !resp.blocked() {
+			t.Errorf("%s: code %d %q, want 403", tt.name, resp.code, resp.http)
+		}
+		if !tt.blocked && resp.code != 204 {
+			t.Errorf("%s: code %d, want 204", tt.name, resp.code)
+		}
+	}
+}
+
+// multipart格式错误时检测整个报文体
+func TestICAPMalformedMultipart(t *testing.T) {
+	addr, _ := startICAP(t, icapTestConfig{})
+	c := dialICAP(t, addr)
+	for _, tt := range []struct {
+		name, content string
+		blocked       bool
+	}{
+		{"shell.php", testShell, true},
+		{"a.jpg", testBenign, false},
+	} {
+		hdr, body := multipartBody(tt.name, tt.content)
+		body = bytes.TrimSuffix(body, []byte("\r\n--XyZ--\r\n"))
+		resp := c.do(icapMessage{allow: true, httpHdr: hdr, body: body})
+		if resp.blocked() != tt.blocked || !tt.blocked && resp.code != 204 {
+			t.Errorf("%s without closing boundary: code %d %q, blocked %t", tt.name, resp.code, resp.http, tt.blocked)
+		}
+	}
+}
+
+func TestICAPOversize(t *testing.T) {
+	const maxSize = 2000
+	shells := bytes.Repeat([]byte(testShell), maxSize/len(testShell)+10)
+	benign := bytes.Repeat([]byte(testBenign), maxSize/len(testBenign)+10)
+	tests := []struct {
+		policy string
+		allow  bool
+		body   []byte
+		code   int
+		block  bool
+	}{
+		{icapOversizeBlock, true, benign, 200, true},
+		{icapOversizeBlock, true, shells, 200, true},
+		{icapOversizeScan, true, shells, 200, true},
+		{icapOversizeScan, true, benign, 204, false},
+		// 报文体已被截断，无法原样返回
+		{icapOversizeScan, false, benign, 500, false},
+	}
+	for _, tt := range tests {
+		addr, _ := startICAP(t, icapTestConfig{maxSize: maxSize, oversize: tt.policy})
+		c := dialICAP(t, addr)
+		resp := c.do(icapMessage{allow: tt.allow, httpHdr: putRequest("x.php"), body: tt.body})
+		if resp.code != tt.code || resp.blocked() != tt.block {
+			t.Errorf("-icap-oversize %s, Allow: 204 %t: code %d %q, want %d blocked %t", tt.policy, tt.allow, resp.code, resp.http, tt.code, tt.block)
+		}
+	}
+}
+
+func TestICAPContentEncoding(t *testing.T) {
+	addr, _ := startICAP(t, icapTestConfig{})
+	c := dialICAP(t, addr)
+	gz := func(s string) []byte {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		_, _ = zw.Write([]byte(s))
+		_ = zw.Close()
+		return b.Bytes()
+	}
+	resHdr := func(encoding string) string {
+		return "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Encoding: " + encoding +
+			"\r\nContent-Disposition: attachment; filename=\"dl.php\"\r\n\r\n"
+	}
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		blocked  bool
+	}{
+		{"gzip shell", "gzip", gz(testShell), true},
+		{"gzip benign", "gzip", gz(testBenign), false},
+		{"unsupported encoding", "br", []byte("xxxx"), true},
+		{"corrupt gzip", "gzip", []byte("not gzip"), true},
+	}
+	for _, tt := range tests {
+		resp := c.do(icapMessage{method: "RESPMOD", allow: true, httpHdr: resHdr(tt.encoding), body: tt.body})
+		if resp.blocked() != tt.blocked || !tt.blocked && resp.code != 204 {
+			t.Errorf("%s: code %d %q, want blocked %t", tt.name, resp.code, resp.http, tt.blocked)
+		}
+	}
+}
+
+// 嵌套超过层数的压缩包检测出错
+func TestICAPScanError(t *testing.T) {
+	var inner, outer bytes.Buffer
+	zw := zip.NewWriter(&inner)
+	w, _ := zw.Create("a.txt")
+	_, _ = w.Write([]byte(testBenign))
+	_ = zw.Close()
+	zw = zip.NewWriter(&outer)
+	w, _ = zw.Create("inner.zip")
+	_, _ = w.Write(inner.Bytes())
+	_ = zw.Close()
+
+	limits := scanner.DefaultArchiveLimits
+	limits.MaxDepth = 1
+	for _, tt := range []struct {
+		policy string
+		code   int
+	}{
+		{icapScanErrorBlock, 200},
+		{icapScanErrorAllow, 204},
+	} {
+		addr, _ := startICAP(t, icapTestConfig{scanError: tt.policy, options: []scanner.Option{scanner.WithArchiveLimits(limits)}})
+		c := dialICAP(t, addr)
+		resp := c.do(icapMessage{allow: true, httpHdr: putRequest("a.zip"), body: outer.Bytes()})
+		if resp.code != tt.code || (tt.code == 200) != resp.blocked() {
+			t.Errorf("-icap-scan-error %s: code %d %q, want %d", tt.policy, resp.code, resp.http, tt.code)
+		}
+	}
+}
+
+func TestICAPHeaderLimits(t *testing.T) {
+	addr, _ := startICAP(t, icapTestConfig{})
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"icap header", "OPTIONS icap://127.0.0.1/reqmod ICAP/1.0\r\nX-Pad: " + strings.Repeat("a", icapMaxHeaderBytes) + "\r\n\r\n"},
+		{"encapsulated offset", "REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\nHost: x\r\nEncapsulated: req-hdr=0, req-body=9000000000000000000\r\n\r\n"},
+		{"encapsulated header", fmt.Sprintf("REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\nHost: x\r\nEncapsulated: req-hdr=0, req-body=%d\r\n\r\n", icapMaxHeaderBytes+1)},
+		{"chunk line", "REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\nHost: x\r\nEncapsulated: req-hdr=0, req-body=30\r\n\r\n" +
+			putRequest("a") + strings.Repeat("1", 10000)},
+	}
+	for _, tt := range tests {
+		c := dialICAP(t, addr)
+		c.send([]byte(tt.msg))
+		if resp := c.read(); resp.code != 400 || resp.header.Get("Connection") != "close" {
+			t.Errorf("%s: code %d, want 400 and close", tt.name, resp.code)
+		}
+	}
+}
+
+func TestICAPMaxConnections(t *testing.T) {
+	addr, is := startICAP(t, icapTestConfig{concurrency: 1})
+	// 每个连接先完成一个请求，确保已被服务接受
+	for i := 0; i < is.maxConns; i++ {
+		c := dialICAP(t, addr)
+		c.send([]byte("OPTIONS icap://127.0.0.1/reqmod ICAP/1.0\r\nHost: 127.0.0.1\r\n\r\n"))
+		if resp := c.read(); resp.code != 200 {
+			t.Fatalf("connection %d: code %d, want 200", i, resp.code)
+		}
+	}
+	c := dialICAP(t, addr)
+	if resp := c.read(); resp.code != 503 {
+		t.Errorf("connection over Max-Connections: code %d, want 503", resp.code)
+	}
+}
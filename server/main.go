@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+	"wxel/scanner"
+)
+
+const (
+	DefaultListen    = ":8080"
+	DefaultThreshold = 50
+
+	// multipart请求中除文件内容外的边界、头部等开销
+	multipartOverhead = 64 * 1024
+)
+
+type server struct {
+	scanner      *scanner.Scanner
+	threshold    float64
+	maxSize      int64
+	slots        chan struct{} // 同时读取及检测的请求数上限
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	metrics      *metrics
+}
+
+// 上传的一个文件的检测结论，压缩包中每个文件对应一个结果，得分取最高的结果
+type verdict struct {
+	Filename string            `json:"filename"`
+	Detected bool              `json:"detected"`
+	Score    float64           `json:"score"`
+	Results  []*scanner.Result `json:"results"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+type scanResponse struct {
+	Detected  bool       `json:"detected"` // 任一文件得分不低于阈值
+	Threshold float64    `json:"threshold"`
+	Files     []*verdict `json:"files"`
+}
+
+type upload struct {
+	name    string
+	content []byte
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(v)
+}
+
+func (sv *server) fail(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	sv.metrics.request(code)
+	writeJSON(w, code, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// POST /v1/scan，请求体为multipart/form-data（检测其中所有文件）或文件的原始内容，
+// 原始内容的文件名通过filename参数或X-Filename头指定，用于判断文件类型
+func (sv *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		sv.fail(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+		return
+	}
+	threshold := sv.threshold
+	if t := r.URL.Query().Get("threshold"); t != "" {
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil || v < 0 || v > 100 {
+			sv.fail(w, http.StatusBadRequest, "invalid threshold: %s", t)
+			return
+		}
+		threshold = v
+	}
+
+	// 检测最多持续到无法写入响应时
+	ctx, cancel := context.WithTimeout(r.Context(), sv.writeTimeout)
+	defer cancel()
+	// 先占用检测位置再读取请求体，内存中的请求体不超过-c个
+	if err := sv.acquire(ctx); err != nil {
+		sv.fail(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer sv.release()
+	// 等待检测位置的时间不计入读取请求体的时间
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(sv.readTimeout))
+
+	uploads, err := sv.readUploads(w, r)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sv.fail(w, http.StatusRequestEntityTooLarge, "request body exceeds %d bytes", sv.maxSize)
+			return
+		}
+		sv.fail(w, http.StatusBadRequest, "read request error: %v", err)
+		return
+	}
+	if len(uploads) == 0 {
+		sv.fail(w, http.StatusBadRequest, "no file found in request")
+		return
+	}
+
+	resp, err := sv.scan(ctx, uploads, threshold)
+	if err != nil {
+		sv.fail(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	sv.metrics.request(http.StatusOK)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// 等待空闲的检测位置，ctx结束时放弃等待。成功时需要调用release
+func (sv *server) acquire(ctx context.Context) error {
+	sv.metrics.begin()
+	select {
+	case sv.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		sv.metrics.end()
+		return fmt.Errorf("request canceled while waiting for a scan slot")
+	}
+}
+
+func (sv *server) release() {
+	<-sv.slots
+	sv.metrics.end()
+}
+
+// 检测上传的文件，调用前需要占用检测位置，ctx结束时停止检测并返回错误
+func (sv *server) scan(ctx context.Context, uploads []upload, threshold float64) (*scanResponse, error) {
+	start := time.Now()
+	resp := &scanResponse{Threshold: threshold, Files: []*verdict{}}
+	size, files, detected, errs := 0, 0, 0, 0
+	for _, u := range uploads {
+		v := &verdict{Filename: u.name, Results: []*scanner.Result{}}
+		for _, res := range sv.scanner.ScanContentContext(ctx, u.content, u.name) {
+			files++
+			if res.Err != nil {
+				errs++
+				v.Errors = append(v.Errors, res.Err.Error())
+				continue
+			}
+			if res.Score >= threshold {
+				detected++
+			}
+			if res.Score > v.Score {
+				v.Score = res.Score
+			}
+			v.Results = append(v.Results, res)
+		}
+		v.Detected = len(v.Results) > 0 && v.Score >= threshold
+		resp.Detected = resp.Detected || v.Detected
+		resp.Files = append(resp.Files, v)
+		size += len(u.content)
+	}
+	sv.metrics.scanned(size, time.Since(start), files, detected, errs)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("scan canceled: %v", err)
+	}
+	return resp, nil
+}
+
+func (sv *server) readUploads(w http.ResponseWriter, r *http.Request) ([]upload, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, sv.maxSize)
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		name := r.URL.Query().Get("filename")
+		if name == "" {
+			name = r.Header.Get("X-Filename")
+		}
+		if name == "" {
+			name = "upload"
+		}
+		return []upload{{name: name, content: content}}, nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, sv.maxSize+multipartOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var uploads []upload
+	total := int64(0)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return uploads, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 只检测文件，忽略普通的表单字段
+		if part.FileName() == "" {
+			continue
+		}
+		content, err := ioutil.ReadAll(io.LimitReader(part, sv.maxSize-total+1))
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(content))
+		if total > sv.maxSize {
+			return nil, &http.MaxBytesError{Limit: sv.maxSize}
+		}
+		uploads = append(uploads, upload{name: part.FileName(), content: content})
+	}
+}
+
+func (sv *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (sv *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	sv.metrics.write(w)
+}
+
+func run() int {
+	var listen string
+	var module string
+	var threshold float64
+	var rules string
+	var rulesOnly bool
+	var yaraRules string
+	var archives bool
+	var concurrency int
+	var maxSize int64
+	var readTimeout time.Duration
+	var writeTimeout time.Duration
+	var shutdownTimeout time.Duration
+	var icapListen string
+	var icapOversize string
+	var icapScanError string
+	flag.StringVar(&listen, "l", DefaultListen, "listen address")
+	flag.StringVar(&module, "m", "", "module file trained by xtrainer, default to the embedded module")
+	flag.Float64Var(&threshold, "t", DefaultThreshold, "default threshold (0-100) for the detected verdict, can be overridden by the threshold query parameter")
+	flag.StringVar(&rules, "r", "", "comma separated rule files (yaml or json) extending the built-in plugins")
+	flag.BoolVar(&rulesOnly, "rules-only", false, "use only the plugins from rule files instead of the built-in plugins")
+	flag.StringVar(&yaraRules, "y", "", "comma separated yara rule files, only a subset of yara syntax is supported")
+	flag.BoolVar(&archives, "archive", true, "scan members of uploaded zip, jar, war, ear, tar, tar.gz, tgz and gz archives")
+	flag.IntVar(&concurrency, "c", runtime.NumCPU(), "maximum number of requests scanned at the same time, others wait for a slot")
+	flag.Int64Var(&maxSize, "max-size", scanner.MaxFileSize, "maximum size in bytes of the uploaded content of a request")
+	flag.DurationVar(&readTimeout, "read-timeout", time.Minute, "maximum duration for reading the request body after a scan slot is acquired, or the whole ICAP request")
+	flag.DurationVar(&writeTimeout, "write-timeout", 5*time.Minute, "maximum duration from reading the request headers to writing the response, including waiting for a slot and scanning")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "time to wait for running requests on SIGINT or SIGTERM")
+	flag.StringVar(&icapListen, "icap", "", "also serve ICAP (RFC 3507) REQMOD at icap://host/reqmod and RESPMOD at icap://host/respmod on this address, e.g. "+DefaultICAPListen)
+	flag.StringVar(&icapOversize, "icap-oversize", icapOversizeBlock, "how to handle ICAP messages whose body exceeds -max-size: block returns 403, scan scans only the first -max-size bytes")
+	flag.StringVar(&icapScanError, "icap-scan-error", icapScanErrorBlock, "how to handle ICAP messages in which no webshell is detected but a file fails to scan (e.g. an archive exceeds the limits): block returns 403, allow passes the message")
+	flag.Parse()
+
+	if concurrency <= 0 || maxSize <= 0 || readTimeout <= 0 || writeTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "-c, -max-size, -read-timeout and -write-timeout should be positive")
+		return 2
+	}
+	if icapOversize != icapOversizeBlock && icapOversize != icapOversizeScan {
+		fmt.Fprintf(os.Stderr, "-icap-oversize should be %s or %s \n", icapOversizeBlock, icapOversizeScan)
+		return 2
+	}
+	if icapScanError != icapScanErrorBlock && icapScanError != icapScanErrorAllow {
+		fmt.Fprintf(os.Stderr, "-icap-scan-error should be %s or %s \n", icapScanErrorBlock, icapScanErrorAllow)
+		return 2
+	}
+
+	plugins, err := scanner.LoadPlugins(rules, rulesOnly, yaraRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v \n", err)
+		return 2
+	}
+	opts := []scanner.Option{scanner.WithPlugins(plugins), scanner.WithArchives(archives), scanner.WithMaxFileSize(maxSize)}
+	if module != "" {
+		dn, err := scanner.LoadModel(module)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load module error: %v \n", err)
+			return 2
+		}
+		opts = append(opts, scanner.WithModel(dn))
+	}
+	// 模型及插件只加载一次，所有请求共享
+	s, err := scanner.New(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load module error: %v \n", err)
+		return 2
+	}
+
+	sv := &server{
+		scanner:      s,
+		threshold:    threshold,
+		maxSize:      maxSize,
+		slots:        make(chan struct{}, concurrency),
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		metrics:      newMetrics(concurrency),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/scan", sv.handleScan)
+	mux.HandleFunc("/healthz", sv.handleHealth)
+	mux.HandleFunc("/metrics", sv.handleMetrics)
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// 读取请求头后等待检测位置时会重新设置读取期限
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	fmt.Fprintf(os.Stderr, "listening on %s \n", listen)
+
+	var icap *icapServer
+	if icapListen != "" {
+		ln, err := net.Listen("tcp", icapListen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "listen error: %v \n", err)
+			return 2
+		}
+		icap = newICAPServer(sv, icapOversize, icapScanError)
+		go func() {
+			errs <- icap.Serve(ln)
+		}()
+		fmt.Fprintf(os.Stderr, "icap listening on %s \n", icapListen)
+	}
+
+	select {
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "listen error: %v \n", err)
+		return 2
+	case <-ctx.Done():
+	}
+	// 停止接受新连接，等待处理中的请求完成
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	icapDone := make(chan error, 1)
+	if icap != nil {
+		go func() {
+			icapDone <- icap.Shutdown(shutdownCtx)
+		}()
+	} else {
+		icapDone <- nil
+	}
+	code := 0
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "shutdown error: %v \n", err)
+		code = 2
+	}
+	if err := <-icapDone; err != nil {
+		fmt.Fprintf(os.Stderr, "icap shutdown error: %v \n", err)
+		code = 2
+	}
+	return code
+}
+
+func main() {
+	os.Exit(run())
+}
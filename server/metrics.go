@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Prometheus文本格式的指标
+type metrics struct {
+	mu         sync.Mutex
+	requests   map[int]int64 // 按状态码统计的/v1/scan请求数
+	icap       map[string]map[int]int64
+	files      int64
+	detected   int64
+	errors     int64
+	bytes      int64
+	inFlight   int64
+	scanTime   time.Duration
+	scanCount  int64
+	startedAt  time.Time
+	maxRunning int
+}
+
+func newMetrics(maxRunning int) *metrics {
+	return &metrics{
+		requests:   make(map[int]int64),
+		icap:       make(map[string]map[int]int64),
+		startedAt:  time.Now(),
+		maxRunning: maxRunning,
+	}
+}
+
+func (m *metrics) request(code int) {
+	m.mu.Lock()
+	m.requests[code]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) icapRequest(method string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.icap[method] == nil {
+		m.icap[method] = make(map[int]int64)
+	}
+	m.icap[method][code]++
+}
+
+func (m *metrics) begin() {
+	m.mu.Lock()
+	m.inFlight++
+	m.mu.Unlock()
+}
+
+func (m *metrics) end() {
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+}
+
+func (m *metrics) scanned(size int, elapsed time.Duration, files, detected, errors int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes += int64(size)
+	m.scanTime += elapsed
+	m.scanCount++
+	m.files += int64(files)
+	m.detected += int64(detected)
+	m.errors += int64(errors)
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP wxel_requests_total Scan requests by HTTP status code.")
+	fmt.Fprintln(w, "# TYPE wxel_requests_total counter")
+	var codes []int
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "wxel_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+	fmt.Fprintln(w, "# HELP wxel_icap_requests_total ICAP requests by method and ICAP status code.")
+	fmt.Fprintln(w, "# TYPE wxel_icap_requests_total counter")
+	var methods []string
+	for method := range m.icap {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		codes = codes[:0]
+		for code := range m.icap[method] {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "wxel_icap_requests_total{method=\"%s\",code=\"%d\"} %d\n", method, code, m.icap[method][code])
+		}
+	}
+	counter := func(name, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	counter("wxel_scanned_files_total", "Files scanned, including members of archives.", m.files)
+	counter("wxel_detected_files_total", "Files scoring at or above the threshold.", m.detected)
+	counter("wxel_scan_errors_total", "Files that could not be scanned.", m.errors)
+	counter("wxel_scanned_bytes_total", "Bytes of uploaded content scanned.", m.bytes)
+	fmt.Fprintln(w, "# HELP wxel_scan_duration_seconds Time spent scanning uploaded content.")
+	fmt.Fprintln(w, "# TYPE wxel_scan_duration_seconds summary")
+	fmt.Fprintf(w, "wxel_scan_duration_seconds_sum %g\n", m.scanTime.Seconds())
+	fmt.Fprintf(w, "wxel_scan_duration_seconds_count %d\n", m.scanCount)
+	gauge("wxel_scans_in_flight", "Scans currently reading uploads, running or waiting for a slot.", float64(m.inFlight))
+	gauge("wxel_scan_concurrency_limit", "Maximum number of scans reading uploads or running at the same time.", float64(m.maxRunning))
+	gauge("wxel_uptime_seconds", "Seconds since the server started.", time.Since(m.startedAt).Seconds())
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	deep "github.com/patrikeh/go-deep"
 	"github.com/patrikeh/go-deep/training"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"wxel/core"
 )
 
 const (
@@ -24,6 +26,9 @@ const (
 	trainNum  = 500
 )
 
+// 特征数量：正则得分+计算器数量
+var inputs = len(core.GetCalculators()) + 1
+
 func get_traning_examples() training.Examples {
 	f, err := os.Open("sample/train.csv")
 	if err != nil {
@@ -61,6 +66,10 @@ func toExample(in []string) training.Example {
 	}
 
 	last_index := len(elements) - 1
+	// 新增计算器之前采集的样本缺少后面的特征，补0会使新特征的权重无法学习，需要重新采集样本
+	if last_index != inputs {
+		panic(fmt.Sprintf("sample has %d features, expects %d, regenerate sample/train.csv with sample/main.go", last_index, inputs))
+	}
 	return training.Example{
 		Response: []float64{elements[last_index]},
 		Input:    elements[:last_index],
@@ -73,7 +82,7 @@ func main() {
 	data := get_traning_examples()
 
 	n := deep.NewNeural(&deep.Config{
-		Inputs:     7,
+		Inputs:     inputs,
 		Layout:     []int{7, 7, 1},
 		Activation: deep.ActivationSigmoid,
 		Mode:       deep.ModeMultiLabel,
@@ -0,0 +1,408 @@
+package yara
+
+import (
+	"fmt"
+	"path"
+)
+
+// 条件求值的上下文，matches保存当前规则每个字符串的匹配结果，rules保存之前规则的结果
+type context struct {
+	matches     map[string][]match
+	rules       map[string]bool
+	ruleMatches map[string]map[string][]match
+	filesize    int64
+}
+
+type expr interface {
+	eval(ctx *context) int64
+}
+
+type boolExpr struct {
+	value bool
+}
+
+type numberExpr struct {
+	value int64
+}
+
+type filesizeExpr struct{}
+
+type ruleExpr struct {
+	name string
+}
+
+type notExpr struct {
+	operand expr
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+// $a、$a at n、$a in (n..m)
+type stringExpr struct {
+	id       string
+	at       expr
+	from, to expr
+}
+
+// #a
+type countExpr struct {
+	id string
+}
+
+// @a[n]
+type offsetExpr struct {
+	id    string
+	index expr
+}
+
+// any/all/none/n of (...)
+type ofExpr struct {
+	quantifier string
+	n          expr
+	ids        []string
+}
+
+func toInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *boolExpr) eval(ctx *context) int64 {
+	return toInt(e.value)
+}
+
+func (e *numberExpr) eval(ctx *context) int64 {
+	return e.value
+}
+
+func (e *filesizeExpr) eval(ctx *context) int64 {
+	return ctx.filesize
+}
+
+func (e *ruleExpr) eval(ctx *context) int64 {
+	return toInt(ctx.rules[e.name])
+}
+
+func (e *notExpr) eval(ctx *context) int64 {
+	return toInt(e.operand.eval(ctx) == 0)
+}
+
+func (e *binaryExpr) eval(ctx *context) int64 {
+	switch e.op {
+	case "and":
+		return toInt(e.left.eval(ctx) != 0 && e.right.eval(ctx) != 0)
+	case "or":
+		return toInt(e.left.eval(ctx) != 0 || e.right.eval(ctx) != 0)
+	}
+	l, r := e.left.eval(ctx), e.right.eval(ctx)
+	switch e.op {
+	case "<":
+		return toInt(l < r)
+	case "<=":
+		return toInt(l <= r)
+	case ">":
+		return toInt(l > r)
+	case ">=":
+		return toInt(l >= r)
+	case "==":
+		return toInt(l == r)
+	case "!=":
+		return toInt(l != r)
+	}
+	return 0
+}
+
+func (e *stringExpr) eval(ctx *context) int64 {
+	ms := ctx.matches[e.id]
+	switch {
+	case e.at != nil:
+		at := e.at.eval(ctx)
+		for _, m := range ms {
+			if int64(m.offset) == at {
+				return 1
+			}
+		}
+		return 0
+	case e.from != nil:
+		from, to := e.from.eval(ctx), e.to.eval(ctx)
+		for _, m := range ms {
+			if int64(m.offset) >= from && int64(m.offset) <= to {
+				return 1
+			}
+		}
+		return 0
+	}
+	return toInt(len(ms) > 0)
+}
+
+func (e *countExpr) eval(ctx *context) int64 {
+	return int64(len(ctx.matches[e.id]))
+}
+
+func (e *offsetExpr) eval(ctx *context) int64 {
+	index := int64(1)
+	if e.index != nil {
+		index = e.index.eval(ctx)
+	}
+	ms := ctx.matches[e.id]
+	if index < 1 || index > int64(len(ms)) {
+		return -1
+	}
+	return int64(ms[index-1].offset)
+}
+
+func (e *ofExpr) eval(ctx *context) int64 {
+	matched := int64(0)
+	for _, id := range e.ids {
+		if len(ctx.matches[id]) > 0 {
+			matched++
+		}
+	}
+	switch e.quantifier {
+	case "any":
+		return toInt(matched > 0)
+	case "all":
+		return toInt(matched == int64(len(e.ids)))
+	case "none":
+		return toInt(matched == 0)
+	}
+	return toInt(matched >= e.n.eval(ctx))
+}
+
+func (p *parser) parseExpr(rule *Rule) (expr, error) {
+	left, err := p.parseAnd(rule)
+	if err != nil {
+		return nil, err
+	}
+	for p.is(tokIdent, "or") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd(rule)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(rule *Rule) (expr, error) {
+	left, err := p.parseNot(rule)
+	if err != nil {
+		return nil, err
+	}
+	for p.is(tokIdent, "and") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot(rule)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot(rule *Rule) (expr, error) {
+	if p.is(tokIdent, "not") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot(rule)
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parseComparison(rule)
+}
+
+func (p *parser) parseComparison(rule *Rule) (expr, error) {
+	left, err := p.parsePrimary(rule)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokSymbol {
+		switch p.tok.text {
+		case "<", "<=", ">", ">=", "==", "!=":
+			op := p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			right, err := p.parsePrimary(rule)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) stringID(rule *Rule, id string) (string, error) {
+	for _, s := range rule.Strings {
+		if s.ID == id {
+			return id, nil
+		}
+	}
+	return "", p.errorf("undefined string identifier %s", id)
+}
+
+func (p *parser) parsePrimary(rule *Rule) (expr, error) {
+	t := p.tok
+	switch {
+	case p.is(tokSymbol, "("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e, err := p.parseExpr(rule)
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokSymbol, ")")
+		return e, err
+	case t.kind == tokNumber:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is(tokIdent, "of") {
+			return p.parseOf(rule, "", &numberExpr{value: t.value})
+		}
+		return &numberExpr{value: t.value}, nil
+	case t.kind == tokStringID:
+		return p.parseStringExpr(rule)
+	case t.kind == tokCount:
+		id, err := p.stringID(rule, "$"+t.text[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &countExpr{id: id}, p.advance()
+	case t.kind == tokOffset:
+		id, err := p.stringID(rule, "$"+t.text[1:])
+		if err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e := &offsetExpr{id: id}
+		if p.is(tokSymbol, "[") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if e.index, err = p.parseComparison(rule); err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokSymbol, "]"); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	case t.kind == tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &boolExpr{value: t.text == "true"}, p.advance()
+		case "filesize":
+			return &filesizeExpr{}, p.advance()
+		case "any", "all", "none":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			return p.parseOf(rule, t.text, nil)
+		}
+		if p.ruleNames[t.text] {
+			return &ruleExpr{name: t.text}, p.advance()
+		}
+		return nil, p.errorf("unknown identifier %s", t.text)
+	}
+	return nil, p.errorf("unexpected %s in condition", t)
+}
+
+func (p *parser) parseStringExpr(rule *Rule) (expr, error) {
+	id, err := p.stringID(rule, p.tok.text)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	e := &stringExpr{id: id}
+	switch {
+	case p.is(tokIdent, "at"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e.at, err = p.parsePrimary(rule)
+		return e, err
+	case p.is(tokIdent, "in"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokSymbol, "("); err != nil {
+			return nil, err
+		}
+		if e.from, err = p.parsePrimary(rule); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokSymbol, ".."); err != nil {
+			return nil, err
+		}
+		if e.to, err = p.parsePrimary(rule); err != nil {
+			return nil, err
+		}
+		_, err = p.expect(tokSymbol, ")")
+		return e, err
+	}
+	return e, nil
+}
+
+func (p *parser) parseOf(rule *Rule, quantifier string, n expr) (expr, error) {
+	if _, err := p.expect(tokIdent, "of"); err != nil {
+		return nil, err
+	}
+	e := &ofExpr{quantifier: quantifier, n: n}
+	if p.is(tokIdent, "them") {
+		for _, s := range rule.Strings {
+			e.ids = append(e.ids, s.ID)
+		}
+		if len(e.ids) == 0 {
+			return nil, p.errorf("rule %s has no strings", rule.Name)
+		}
+		return e, p.advance()
+	}
+
+	if _, err := p.expect(tokSymbol, "("); err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.expect(tokStringID, "")
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, s := range rule.Strings {
+			if ok, _ := path.Match(t.text, s.ID); ok || s.ID == t.text {
+				found = true
+				e.ids = append(e.ids, s.ID)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("line %d: undefined string identifier %s", t.line, t.text)
+		}
+		if !p.is(tokSymbol, ",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	_, err := p.expect(tokSymbol, ")")
+	return e, err
+}
@@ -0,0 +1,248 @@
+package yara
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokString   // "text"
+	tokHex      // { 4D 5A ?? }
+	tokRegex    // /regex/flags
+	tokNumber   // 10, 0x10, 10KB
+	tokStringID // $a
+	tokCount    // #a
+	tokOffset   // @a
+	tokSymbol
+)
+
+type token struct {
+	kind  int
+	text  string
+	value int64
+	line  int
+	pos   int // 在源码中的起始位置
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+
+	// 是否处于strings段的赋值右侧，此时'{'表示十六进制字符串
+	expectValue bool
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	start := l.pos
+	t, err := l.scan()
+	t.pos = start
+	return t, err
+}
+
+func (l *lexer) scan() (token, error) {
+	expectValue := l.expectValue
+	l.expectValue = false
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '"':
+		return l.lexString()
+	case c == '{' && expectValue:
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return token{}, l.errorf("unterminated hex string")
+		}
+		text := l.src[l.pos+1 : l.pos+end]
+		l.line += strings.Count(text, "\n")
+		l.pos += end + 1
+		return token{kind: tokHex, text: text, line: l.line}, nil
+	case c == '/' && expectValue:
+		return l.lexRegex()
+	case c == '$' || c == '#' || c == '@':
+		l.pos++
+		for l.pos < len(l.src) && (isIdentChar(l.src[l.pos]) || l.src[l.pos] == '*') {
+			l.pos++
+		}
+		kind := map[byte]int{'$': tokStringID, '#': tokCount, '@': tokOffset}[c]
+		return token{kind: kind, text: l.src[start:l.pos], line: l.line}, nil
+	case isDigit(c):
+		return l.lexNumber()
+	case isIdentChar(c):
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], line: l.line}, nil
+	}
+
+	for _, sym := range []string{"..", "<=", ">=", "==", "!=", "<", ">", "=", "(", ")", "{", "}", "[", "]", ",", ":", "-"} {
+		if strings.HasPrefix(l.src[l.pos:], sym) {
+			l.pos += len(sym)
+			if sym == "=" {
+				l.expectValue = true
+			}
+			return token{kind: tokSymbol, text: sym, line: l.line}, nil
+		}
+	}
+	return token{}, l.errorf("unexpected character %q", c)
+}
+
+func (l *lexer) lexString() (token, error) {
+	var sb strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokString, text: sb.String(), line: l.line}, nil
+		case '\n':
+			return token{}, l.errorf("unterminated string")
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, l.errorf("unterminated string")
+			}
+			e := l.src[l.pos+1]
+			l.pos += 2
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '"', '\\':
+				sb.WriteByte(e)
+			case 'x':
+				if l.pos+2 > len(l.src) {
+					return token{}, l.errorf("invalid escape sequence")
+				}
+				var b byte
+				if _, err := fmt.Sscanf(l.src[l.pos:l.pos+2], "%02x", &b); err != nil {
+					return token{}, l.errorf("invalid escape sequence \\x%s", l.src[l.pos:l.pos+2])
+				}
+				sb.WriteByte(b)
+				l.pos += 2
+			default:
+				return token{}, l.errorf("invalid escape sequence \\%c", e)
+			}
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf("unterminated string")
+}
+
+func (l *lexer) lexRegex() (token, error) {
+	var sb strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '/':
+			l.pos++
+			sb.WriteByte('/')
+			for l.pos < len(l.src) && (l.src[l.pos] == 'i' || l.src[l.pos] == 's') {
+				sb.WriteByte(l.src[l.pos])
+				l.pos++
+			}
+			return token{kind: tokRegex, text: sb.String(), line: l.line}, nil
+		case '\n':
+			return token{}, l.errorf("unterminated regular expression")
+		case '\\':
+			if l.pos+1 < len(l.src) && l.src[l.pos+1] == '/' {
+				sb.WriteByte('/')
+			} else if l.pos+1 < len(l.src) {
+				sb.WriteString(l.src[l.pos : l.pos+2])
+			}
+			l.pos += 2
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf("unterminated regular expression")
+}
+
+func (l *lexer) lexNumber() (token, error) {
+	start := l.pos
+	var value int64
+	if strings.HasPrefix(l.src[l.pos:], "0x") {
+		l.pos += 2
+		for l.pos < len(l.src) && strings.IndexByte("0123456789abcdefABCDEF", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+		if _, err := fmt.Sscanf(l.src[start+2:l.pos], "%x", &value); err != nil {
+			return token{}, l.errorf("invalid number %s", l.src[start:l.pos])
+		}
+	} else {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			value = value*10 + int64(l.src[l.pos]-'0')
+			l.pos++
+		}
+	}
+	if strings.HasPrefix(l.src[l.pos:], "KB") {
+		value *= 1024
+		l.pos += 2
+	} else if strings.HasPrefix(l.src[l.pos:], "MB") {
+		value *= 1024 * 1024
+		l.pos += 2
+	}
+	return token{kind: tokNumber, text: l.src[start:l.pos], value: value, line: l.line}, nil
+}
@@ -0,0 +1,274 @@
+package yara
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+type parser struct {
+	lex  *lexer
+	tok  token
+	peek *token
+
+	// 已解析的规则名，条件中可以引用之前的规则
+	ruleNames map[string]bool
+}
+
+func (p *parser) advance() error {
+	if p.peek != nil {
+		p.tok = *p.peek
+		p.peek = nil
+		return nil
+	}
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *parser) lookahead() (token, error) {
+	if p.peek == nil {
+		t, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek = &t
+	}
+	return *p.peek, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.tok.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) is(kind int, text string) bool {
+	return p.tok.kind == kind && (text == "" || p.tok.text == text)
+}
+
+func (p *parser) expect(kind int, text string) (token, error) {
+	if !p.is(kind, text) {
+		if text != "" {
+			return token{}, p.errorf("expected %q, found %s", text, p.tok)
+		}
+		return token{}, p.errorf("unexpected %s", p.tok)
+	}
+	t := p.tok
+	return t, p.advance()
+}
+
+func LoadRules(path string) ([]*Rule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read yara rules %s error: %v", path, err)
+	}
+	rules, err := ParseRules(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+func ParseRules(src string) ([]*Rule, error) {
+	p := &parser{lex: &lexer{src: src, line: 1}, ruleNames: make(map[string]bool)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	for !p.is(tokEOF, "") {
+		if p.is(tokIdent, "import") || p.is(tokIdent, "include") {
+			return nil, p.errorf("%s is not supported", p.tok.text)
+		}
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		p.ruleNames[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (p *parser) parseRule() (*Rule, error) {
+	rule := &Rule{Meta: make(map[string]interface{}), Score: DefaultScore}
+	start := p.tok.pos
+	for p.is(tokIdent, "private") || p.is(tokIdent, "global") {
+		if p.tok.text == "private" {
+			rule.Private = true
+		} else {
+			rule.Global = true
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(tokIdent, "rule"); err != nil {
+		return nil, err
+	}
+	name, err := p.expect(tokIdent, "")
+	if err != nil {
+		return nil, err
+	}
+	if p.ruleNames[name.text] {
+		return nil, p.errorf("duplicated rule %s", name.text)
+	}
+	rule.Name = name.text
+
+	if p.is(tokSymbol, ":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for p.is(tokIdent, "") {
+			rule.Tags = append(rule.Tags, p.tok.text)
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := p.expect(tokSymbol, "{"); err != nil {
+		return nil, err
+	}
+
+	for !p.is(tokSymbol, "}") {
+		section, err := p.expect(tokIdent, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokSymbol, ":"); err != nil {
+			return nil, err
+		}
+		switch section.text {
+		case "meta":
+			err = p.parseMeta(rule)
+		case "strings":
+			err = p.parseStrings(rule)
+		case "condition":
+			rule.Condition, err = p.parseExpr(rule)
+		default:
+			err = fmt.Errorf("line %d: unknown section %s", section.line, section.text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+	}
+	if rule.Condition == nil {
+		return nil, p.errorf("rule %s: condition is required", rule.Name)
+	}
+	rule.source = p.lex.src[start : p.tok.pos+1]
+	return rule, p.advance()
+}
+
+func (p *parser) isSectionStart() (bool, error) {
+	if !p.is(tokIdent, "") {
+		return false, nil
+	}
+	next, err := p.lookahead()
+	if err != nil {
+		return false, err
+	}
+	return next.kind == tokSymbol && next.text == ":", nil
+}
+
+func (p *parser) parseMeta(rule *Rule) error {
+	for {
+		if end, err := p.isSectionStart(); err != nil || end || p.is(tokSymbol, "}") {
+			return err
+		}
+		key, err := p.expect(tokIdent, "")
+		if err != nil {
+			return err
+		}
+		if _, err := p.expect(tokSymbol, "="); err != nil {
+			return err
+		}
+
+		negative := false
+		if p.is(tokSymbol, "-") {
+			negative = true
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		var value interface{}
+		switch {
+		case p.tok.kind == tokString:
+			value = p.tok.text
+		case p.tok.kind == tokNumber:
+			n := p.tok.value
+			if negative {
+				n = -n
+			}
+			value = n
+		case p.is(tokIdent, "true"):
+			value = true
+		case p.is(tokIdent, "false"):
+			value = false
+		default:
+			return p.errorf("invalid meta value %s", p.tok)
+		}
+		rule.Meta[key.text] = value
+		if key.text == "score" {
+			n, ok := value.(int64)
+			if !ok {
+				return p.errorf("meta score should be a number")
+			}
+			rule.Score = float64(n)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseStrings(rule *Rule) error {
+	for p.is(tokStringID, "") {
+		id := p.tok
+		if id.text == "$" || strings.Contains(id.text, "*") {
+			return p.errorf("invalid string identifier %s", id.text)
+		}
+		for _, s := range rule.Strings {
+			if s.ID == id.text {
+				return p.errorf("duplicated string identifier %s", id.text)
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.expect(tokSymbol, "="); err != nil {
+			return err
+		}
+
+		value := p.tok
+		if value.kind != tokString && value.kind != tokHex && value.kind != tokRegex {
+			return p.errorf("invalid value of string %s", id.text)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+
+		var modifiers []string
+		for p.is(tokIdent, "") {
+			if end, err := p.isSectionStart(); err != nil || end {
+				if err != nil {
+					return err
+				}
+				break
+			}
+			modifiers = append(modifiers, p.tok.text)
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+
+		s, err := compileString(id.text, value, modifiers)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", id.line, err)
+		}
+		rule.Strings = append(rule.Strings, s)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package yara
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// 单个字符串最多记录的匹配数量
+	MaxMatches = 1000
+)
+
+type String struct {
+	ID       string
+	Private  bool
+	fullword bool
+	regex    *regexp.Regexp
+}
+
+type match struct {
+	offset int
+	length int
+	data   string
+}
+
+// 数据按字节逐个转换为Latin-1字符后再匹配，使十六进制字符串及\xHH可以匹配任意字节
+func toLatin1(data string) string {
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for i := 0; i < len(data); i++ {
+		sb.WriteRune(rune(data[i]))
+	}
+	return sb.String()
+}
+
+func fromLatin1(data string) string {
+	b := make([]byte, 0, len(data))
+	for _, r := range data {
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+func byteLiteral(b byte) string {
+	return fmt.Sprintf(`\x{%02x}`, b)
+}
+
+func compileString(id string, value token, modifiers []string) (*String, error) {
+	var nocase, wide, ascii, fullword, private bool
+	for _, m := range modifiers {
+		switch m {
+		case "nocase":
+			nocase = true
+		case "wide":
+			wide = true
+		case "ascii":
+			ascii = true
+		case "fullword":
+			fullword = true
+		case "private":
+			private = true
+		default:
+			return nil, fmt.Errorf("string %s: modifier %s is not supported", id, m)
+		}
+	}
+
+	var expr string
+	switch value.kind {
+	case tokString:
+		if value.text == "" {
+			return nil, fmt.Errorf("string %s: empty string", id)
+		}
+		var plain, wideExpr strings.Builder
+		for i := 0; i < len(value.text); i++ {
+			plain.WriteString(byteLiteral(value.text[i]))
+			wideExpr.WriteString(byteLiteral(value.text[i]) + byteLiteral(0))
+		}
+		switch {
+		case wide && ascii:
+			expr = "(?:" + plain.String() + "|" + wideExpr.String() + ")"
+		case wide:
+			expr = wideExpr.String()
+		default:
+			expr = plain.String()
+		}
+	case tokHex:
+		if nocase || wide || ascii || fullword {
+			return nil, fmt.Errorf("string %s: hex strings only support private modifier", id)
+		}
+		e, err := compileHex(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("string %s: %v", id, err)
+		}
+		expr = e
+	case tokRegex:
+		if wide {
+			return nil, fmt.Errorf("string %s: wide modifier is not supported by regular expressions", id)
+		}
+		i := strings.LastIndexByte(value.text, '/')
+		expr = value.text[:i]
+		if flags := value.text[i+1:]; flags != "" {
+			expr = "(?" + flags + ")" + expr
+		}
+	}
+
+	if nocase {
+		expr = "(?i)" + expr
+	}
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("string %s: %v", id, err)
+	}
+	return &String{ID: id, Private: private, fullword: fullword, regex: regex}, nil
+}
+
+// 十六进制字符串转换为正则，支持??及半字节通配符、[n]/[n-m]/[n-]/[-]跳转和(AA|BB)可选项
+func compileHex(text string) (string, error) {
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ", "|", " | ", "[", " [", "]", "] ").Replace(text))
+	var sb strings.Builder
+	depth := 0
+	count := 0
+	for _, f := range fields {
+		switch {
+		case f == "(":
+			depth++
+			sb.WriteString("(?:")
+		case f == ")":
+			if depth == 0 {
+				return "", fmt.Errorf("unbalanced ) in hex string")
+			}
+			depth--
+			sb.WriteString(")")
+		case f == "|":
+			if depth == 0 {
+				return "", fmt.Errorf("alternative outside of parentheses in hex string")
+			}
+			sb.WriteString("|")
+		case strings.HasPrefix(f, "["):
+			jump, err := compileJump(strings.TrimSuffix(strings.TrimPrefix(f, "["), "]"))
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(jump)
+		default:
+			if len(f)%2 != 0 {
+				return "", fmt.Errorf("invalid hex token %s", f)
+			}
+			for i := 0; i < len(f); i += 2 {
+				b, err := compileHexByte(f[i : i+2])
+				if err != nil {
+					return "", err
+				}
+				sb.WriteString(b)
+				count++
+			}
+		}
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("unbalanced ( in hex string")
+	}
+	if count == 0 {
+		return "", fmt.Errorf("empty hex string")
+	}
+	return "(?s)" + sb.String(), nil
+}
+
+func compileHexByte(h string) (string, error) {
+	if h == "??" {
+		return ".", nil
+	}
+	if h[0] == '?' || h[1] == '?' {
+		var alternatives []string
+		for i := 0; i < 16; i++ {
+			var s string
+			if h[0] == '?' {
+				s = fmt.Sprintf("%x%c", i, h[1])
+			} else {
+				s = fmt.Sprintf("%c%x", h[0], i)
+			}
+			b, err := strconv.ParseUint(s, 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid hex token %s", h)
+			}
+			alternatives = append(alternatives, byteLiteral(byte(b)))
+		}
+		return "[" + strings.Join(alternatives, "") + "]", nil
+	}
+	b, err := strconv.ParseUint(h, 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid hex token %s", h)
+	}
+	return byteLiteral(byte(b)), nil
+}
+
+func compileJump(j string) (string, error) {
+	j = strings.TrimSpace(j)
+	if j == "-" {
+		return ".*?", nil
+	}
+	parts := strings.SplitN(j, "-", 2)
+	low, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("invalid jump [%s]", j)
+	}
+	if len(parts) == 1 {
+		return fmt.Sprintf(".{%d}", low), nil
+	}
+	if strings.TrimSpace(parts[1]) == "" {
+		return fmt.Sprintf(".{%d,}", low), nil
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || high < low {
+		return "", fmt.Errorf("invalid jump [%s]", j)
+	}
+	return fmt.Sprintf(".{%d,%d}", low, high), nil
+}
+
+func isWordBoundary(latin1 string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(latin1[:start])
+	after, _ := utf8.DecodeRuneInString(latin1[end:])
+	return !isWordChar(before) && !isWordChar(after)
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')
+}
+
+func (s *String) find(latin1 string) []match {
+	var matches []match
+	pos, offset := 0, 0
+	for _, loc := range s.regex.FindAllStringIndex(latin1, MaxMatches) {
+		start, end := loc[0], loc[1]
+		// fullword时前后的字符不能是字母、数字或下划线，边界字符不属于匹配内容，相邻的匹配都能找到
+		if s.fullword && !isWordBoundary(latin1, start, end) {
+			continue
+		}
+		offset += utf8.RuneCountInString(latin1[pos:start])
+		pos = start
+		data := fromLatin1(latin1[start:end])
+		matches = append(matches, match{offset: offset, length: len(data), data: data})
+	}
+	return matches
+}
@@ -0,0 +1,113 @@
+package yara
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"wxel/core"
+)
+
+const (
+	YARA = "yara"
+
+	// 规则未通过meta指定score时的得分
+	DefaultScore = 50
+)
+
+type Rule struct {
+	Name      string
+	Tags      []string
+	Meta      map[string]interface{}
+	Strings   []*String
+	Condition expr
+	Score     float64
+	Private   bool
+	Global    bool
+
+	source string // 规则的源码，用于计算规则集的指纹
+}
+
+// 实现core.Matcher，按顺序对数据求值所有规则
+type Ruleset struct {
+	rules []*Rule
+}
+
+func NewRuleset(rules []*Rule) *Ruleset {
+	return &Ruleset{rules: rules}
+}
+
+func (rs *Ruleset) Rules() []string {
+	var names []string
+	for _, r := range rs.rules {
+		if !r.Private {
+			names = append(names, YARA+"/"+r.Name)
+		}
+	}
+	return names
+}
+
+// 规则源码的摘要，规则变化时检测结果缓存失效
+func (rs *Ruleset) Fingerprint() string {
+	h := sha256.New()
+	for _, r := range rs.rules {
+		h.Write([]byte(r.source))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (rs *Ruleset) Match(data string) []core.MatcherHit {
+	latin1 := toLatin1(data)
+	ctx := &context{
+		rules:       make(map[string]bool),
+		ruleMatches: make(map[string]map[string][]match),
+		filesize:    int64(len(data)),
+	}
+
+	var hits []core.MatcherHit
+	// global规则不满足时所有规则都不命中
+	for _, r := range rs.rules {
+		if r.Global && !rs.evaluate(r, ctx, latin1) {
+			return nil
+		}
+	}
+	for _, r := range rs.rules {
+		if !rs.evaluate(r, ctx, latin1) || r.Private {
+			continue
+		}
+		hit := core.MatcherHit{Rule: YARA + "/" + r.Name, Scored: r.Score}
+		for _, s := range r.Strings {
+			if ms := ctx.ruleMatches[r.Name][s.ID]; len(ms) > 0 && !s.Private {
+				hit.Snippet = ms[0].data
+				hit.Offset = ms[0].offset
+				break
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+func (rs *Ruleset) evaluate(r *Rule, ctx *context, latin1 string) bool {
+	if matched, ok := ctx.rules[r.Name]; ok {
+		return matched
+	}
+	ctx.matches = make(map[string][]match)
+	for _, s := range r.Strings {
+		ctx.matches[s.ID] = s.find(latin1)
+	}
+	matched := r.Condition.eval(ctx) != 0
+	ctx.rules[r.Name] = matched
+	ctx.ruleMatches[r.Name] = ctx.matches
+	return matched
+}
+
+func NewPlugin(rules []*Rule) *core.Plugin {
+	return &core.Plugin{
+		Name:     YARA,
+		Desc:     "A plugin that detects webshell with yara rules",
+		Decoders: []core.Decoder{},
+		Tags:     []core.Tag{},
+		Matchers: []core.Matcher{NewRuleset(rules)},
+		Supports: []string{},
+	}
+}
@@ -0,0 +1,190 @@
+package yara
+
+import (
+	"strings"
+	"testing"
+)
+
+func matchedRules(t *testing.T, src, data string) []string {
+	t.Helper()
+	rules, err := ParseRules(src)
+	if err != nil {
+		t.Fatalf("parse %q error: %v", src, err)
+	}
+	var names []string
+	for _, hit := range NewRuleset(rules).Match(data) {
+		names = append(names, strings.TrimPrefix(hit.Rule, YARA+"/"))
+	}
+	return names
+}
+
+// 单条规则r是否命中
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		strings string
+		cond    string
+		data    string
+		match   bool
+	}{
+		// 文本字符串及修饰符
+		{"text", `$a = "eval("`, "$a", "<?php eval($_POST[1]);", true},
+		{"text case", `$a = "EVAL("`, "$a", "<?php eval($_POST[1]);", false},
+		{"nocase", `$a = "EVAL(" nocase`, "$a", "<?php eval($_POST[1]);", true},
+		{"escape", `$a = "a\x00b\tc\"d"`, "$a", "a\x00b\tc\"d", true},
+		{"wide", `$a = "cmd" wide`, "$a", "c\x00m\x00d\x00", true},
+		{"wide only", `$a = "cmd" wide`, "$a", "cmd", false},
+		{"wide ascii", `$a = "cmd" wide ascii`, "#a == 2", "cmd c\x00m\x00d\x00", true},
+		{"wide nocase", `$a = "cmd" wide nocase`, "$a", "C\x00M\x00d\x00", true},
+		{"fullword", `$a = "foo" fullword`, "#a == 3", "foo foo foo", true},
+		{"fullword boundary", `$a = "foo" fullword`, "#a == 2", "foobar foo_x (foo) xfoo foo.", true},
+		{"fullword inside word", `$a = "eval" fullword`, "$a", "medieval", false},
+		{"fullword at edges", `$a = "foo" fullword`, "@a[1] == 0 and @a[2] == 4", "foo foo", true},
+
+		// 十六进制字符串
+		{"hex", `$a = { 3C 3F 70 68 70 }`, "$a at 0", "<?php", true},
+		{"hex wildcard", `$a = { 4D ?? 5A }`, "$a", "M\xffZ", true},
+		{"hex nibble low", `$a = { 4? 5A }`, "$a", "OZ", true},
+		{"hex nibble low mismatch", `$a = { 4? 5A }`, "$a", "ZZ", false},
+		{"hex nibble high", `$a = { ?D 5A }`, "$a", "\x1dZ", true},
+		{"hex jump", `$a = { 61 [2] 64 }`, "$a", "abcd", true},
+		{"hex jump exact", `$a = { 61 [2] 64 }`, "$a", "abd", false},
+		{"hex jump range", `$a = { 61 [1-3] 65 }`, "$a", "abcde", true},
+		{"hex jump range too far", `$a = { 61 [1-2] 65 }`, "$a", "abcde", false},
+		{"hex jump open", `$a = { 61 [2-] 65 }`, "$a", "a0123456789e", true},
+		{"hex jump any", `$a = { 61 [-] 65 }`, "$a", "ae", true},
+		{"hex alternatives", `$a = { 61 ( 62 | 63 64 ) 65 }`, "#a == 2", "abe acde ace", true},
+		{"hex binary", `$a = { 00 FF 0A }`, "$a", "x\x00\xff\ny", true},
+
+		// 正则表达式
+		{"regex", `$a = /ev[a@]l\s*\(/`, "$a", "ev@l (", true},
+		{"regex nocase flag", `$a = /EVAL/i`, "$a", "eval", true},
+		{"regex nocase modifier", `$a = /EVAL/ nocase`, "$a", "eval", true},
+		{"regex dotall", `$a = /a.b/s`, "$a", "a\nb", true},
+		{"regex fullword", `$a = /ev\w+/ fullword`, "#a == 1", "evil xevil", true},
+
+		// 计数、偏移、位置及范围
+		{"count", `$a = "ab"`, "#a == 3", "ab ab ab", true},
+		{"count greater", `$a = "ab"`, "#a > 3", "ab ab ab", false},
+		{"offset", `$a = "ab"`, "@a[2] == 3", "ab ab ab", true},
+		{"offset default", `$a = "ab"`, "@a == 0", "ab ab", true},
+		{"offset missing", `$a = "ab"`, "@a[5] < 0", "ab", true},
+		{"offset multibyte", `$a = "ab"`, "@a[1] == 3", "\xe4\xb8\xadab", true},
+		{"at", `$a = "<?php"`, "$a at 0", "<?php", true},
+		{"at mismatch", `$a = "<?php"`, "$a at 0", " <?php", false},
+		{"in", `$a = "eval"`, "$a in (0..10)", "12345eval", true},
+		{"in mismatch", `$a = "eval"`, "$a in (0..3)", "12345eval", false},
+		{"filesize", `$a = "a"`, "$a and filesize < 10", "abc", true},
+		{"filesize units", `$a = "a"`, "filesize > 1KB", "abc", false},
+
+		// of表达式
+		{"any of them", `$a = "x" $b = "y"`, "any of them", "y", true},
+		{"all of them", `$a = "x" $b = "y"`, "all of them", "y", false},
+		{"none of them", `$a = "x" $b = "y"`, "none of them", "z", true},
+		{"n of", `$a = "x" $b = "y" $c = "z"`, "2 of ($a, $c)", "xz", true},
+		{"n of not enough", `$a = "x" $b = "y" $c = "z"`, "2 of ($a, $b)", "xz", false},
+		{"of wildcard", `$s1 = "x" $s2 = "y" $b = "z"`, "all of ($s*)", "xy", true},
+		{"of wildcard not all", `$s1 = "x" $s2 = "y" $b = "z"`, "all of ($s*)", "xz", false},
+
+		// 布尔运算
+		{"and or not", `$a = "x" $b = "y"`, "$a and not $b or #b == 2", "x y y", true},
+		{"not", `$a = "x" $b = "y"`, "$a and not $b", "x y", false},
+		{"parentheses", `$a = "x" $b = "y" $c = "z"`, "$a and ($b or $c)", "xz", true},
+	}
+	for _, tt := range tests {
+		src := "rule r { strings: " + tt.strings + " condition: " + tt.cond + " }"
+		matched := len(matchedRules(t, src, tt.data)) == 1
+		if matched != tt.match {
+			t.Errorf("%s: %s on %q = %t, want %t", tt.name, src, tt.data, matched, tt.match)
+		}
+	}
+}
+
+func TestPrivateString(t *testing.T) {
+	rules, err := ParseRules(`rule r { strings: $p = "secret" private $a = "eval" condition: all of them }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := NewRuleset(rules).Match("secret eval")
+	// 命中片段不能来自private字符串
+	if len(hits) != 1 || hits[0].Snippet != "eval" || hits[0].Offset != 7 {
+		t.Errorf("hits = %+v, want snippet eval at 7", hits)
+	}
+}
+
+func TestRuleReferences(t *testing.T) {
+	const src = `
+private rule php_file { strings: $a = "<?php" condition: $a at 0 }
+rule php_eval : webshell {
+	meta:
+		score = 80
+	strings:
+		$e = "eval("
+	condition:
+		php_file and $e
+}
+rule not_php { condition: not php_file }
+`
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"<?php eval($x);", []string{"php_eval"}},
+		{"<?php echo 1;", nil},
+		{"eval($x);", []string{"not_php"}},
+	}
+	for _, tt := range tests {
+		if got := matchedRules(t, src, tt.data); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("rules on %q = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+
+	rules, err := ParseRules(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[1].Score != 80 || len(rules[1].Tags) != 1 || rules[1].Tags[0] != "webshell" {
+		t.Errorf("php_eval score %v tags %v, want 80 [webshell]", rules[1].Score, rules[1].Tags)
+	}
+	// private规则不出现在规则列表中
+	if got := strings.Join(NewRuleset(rules).Rules(), ","); got != "yara/php_eval,yara/not_php" {
+		t.Errorf("Rules() = %s", got)
+	}
+}
+
+func TestGlobalRule(t *testing.T) {
+	const src = `
+global rule small { condition: filesize < 100 }
+rule eval { strings: $a = "eval" condition: $a }
+`
+	if got := matchedRules(t, src, "eval"); strings.Join(got, ",") != "small,eval" {
+		t.Errorf("rules on small file = %v, want [small eval]", got)
+	}
+	if got := matchedRules(t, src, "eval"+strings.Repeat(" ", 100)); len(got) != 0 {
+		t.Errorf("rules on large file = %v, want none", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, src, err string
+	}{
+		{"import", `import "pe" rule r { condition: true }`, "import is not supported"},
+		{"include", `include "other.yar" rule r { condition: true }`, "include is not supported"},
+		{"unknown modifier", `rule r { strings: $a = "x" xor condition: $a }`, "modifier xor is not supported"},
+		{"hex modifier", `rule r { strings: $a = { 41 } nocase condition: $a }`, "hex strings only support private"},
+		{"regex wide", `rule r { strings: $a = /x/ wide condition: $a }`, "wide modifier is not supported"},
+		{"hex unbalanced", `rule r { strings: $a = { ( 41 | 42 } condition: $a }`, "unbalanced"},
+		{"hex jump", `rule r { strings: $a = { 41 [3-1] 42 } condition: $a }`, "invalid jump"},
+		{"undefined string", `rule r { strings: $a = "x" condition: $b }`, "undefined string identifier $b"},
+		{"unknown rule", `rule r { condition: other }`, "unknown identifier other"},
+		{"duplicated rule", `rule r { condition: true } rule r { condition: true }`, "duplicated rule r"},
+		{"missing condition", `rule r { strings: $a = "x" }`, "condition is required"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRules(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: ParseRules(%q) error = %v, want %q", tt.name, tt.src, err, tt.err)
+		}
+	}
+}